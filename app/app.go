@@ -16,35 +16,42 @@ package app
 
 import (
 	"bufio"
-	"bytes"
-	"errors"
 	"fmt"
 	"github.com/SierraSoftworks/multicast"
+	"github.com/ccustine/beastie/avr"
+	"github.com/ccustine/beastie/beast"
 	. "github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/dedup"
 	"github.com/ccustine/beastie/input"
 	"github.com/ccustine/beastie/modes"
 	"github.com/ccustine/beastie/output"
+	"github.com/ccustine/beastie/record"
+	"github.com/ccustine/beastie/sbs"
 	"github.com/ccustine/beastie/types"
 	"github.com/cenkalti/backoff"
 	"github.com/google/gops/agent"
 	"github.com/rcrowley/go-metrics"
 	log "github.com/sirupsen/logrus"
-	"math"
+	"io"
 	"net"
 	"sync"
 	"time"
 )
 
 var (
-	magicTimestampMLAT = []byte{0xFF, 0x00, 0x4D, 0x4C, 0x41, 0x54}
-	Info               *BeastInfo
-	knownAircraft      = types.NewAircraftMap()
-	aircraft           = make(chan types.AircraftData, 20) //, 10) This should be investigated, might be better off unbuffered
-	GoodRate           = metrics.GetOrRegisterMeter("Message Rate (Good)", metrics.DefaultRegistry)
-	BadRate            = metrics.GetOrRegisterMeter("Message Rate (Bad)", metrics.DefaultRegistry)
-	ModeACCnt          = metrics.GetOrRegisterCounter("Message Rate (ModeA/C)", metrics.DefaultRegistry)
-	ModesShortCnt      = metrics.GetOrRegisterCounter("Message Rate (ModeS Short)", metrics.DefaultRegistry)
-	ModesLongCnt       = metrics.GetOrRegisterCounter("Message Rate (ModeS Long)", metrics.DefaultRegistry)
+	Info          *BeastInfo
+	knownAircraft = types.NewAircraftMap()
+	aircraft      = make(chan types.AircraftData, 20) //, 10) This should be investigated, might be better off unbuffered
+	frames        = make(chan dedup.Message, 100)
+	sbsMessages   = make(chan sbsMessage, 100)
+	GoodRate      = metrics.GetOrRegisterMeter("Message Rate (Good)", metrics.DefaultRegistry)
+	BadRate       = metrics.GetOrRegisterMeter("Message Rate (Bad)", metrics.DefaultRegistry)
+	ModeACCnt     = metrics.GetOrRegisterCounter("Message Rate (ModeA/C)", metrics.DefaultRegistry)
+	ModesShortCnt = metrics.GetOrRegisterCounter("Message Rate (ModeS Short)", metrics.DefaultRegistry)
+	ModesLongCnt  = metrics.GetOrRegisterCounter("Message Rate (ModeS Long)", metrics.DefaultRegistry)
+	DupRate       = metrics.GetOrRegisterMeter("Message Rate (Duplicate)", metrics.DefaultRegistry)
+	CRCFixedCnt   = metrics.GetOrRegisterCounter("CRC (Fixed)", metrics.DefaultRegistry)
+	CRCFailedCnt  = metrics.GetOrRegisterCounter("CRC (Failed)", metrics.DefaultRegistry)
 	//RtlGoodRate        = metrics.GetOrRegisterMeter("Message Rate (RTL Good)", metrics.DefaultRegistry)
 	//RtlBadRate         = metrics.GetOrRegisterMeter("Message Rate (RTL Bad)", metrics.DefaultRegistry)
 	//done               = make(chan bool)
@@ -59,22 +66,56 @@ type Scanner interface {
 	Error() error
 }
 
+// sbsMessage is a BaseStation message and the receiver it came from, passed
+// to the tracker with the frames of the other sources
+type sbsMessage struct {
+	*sbs.Message
+	Receiver string
+}
+
 type TCPClient struct {
-	Host string
-	Port int
+	Host     string
+	Port     int
+	Format   string
+	recorder *record.Writer
+}
+
+// frameReader is implemented by the readers of each source format
+type frameReader interface {
+	Next() (*beast.Frame, error)
+}
+
+func newFrameReader(format string, r io.Reader) frameReader {
+	switch format {
+	case FORMAT_AVR:
+		return avr.NewReader(r)
+	default:
+		return beast.NewReader(r)
+	}
 }
 
-func (c *TCPClient) start(ac chan<- types.AircraftData) {
+func isBadFrame(err error) bool {
+	return err == beast.ErrShortFrame || err == beast.ErrUnknownType || err == avr.ErrBadLine
+}
+
+func (c *TCPClient) start(sbsOut chan<- sbsMessage, out chan<- dedup.Message) {
+	sourceKey := fmt.Sprintf("%s:%d", c.Host, c.Port)
+	health := types.DefaultSourceRegistry.Register(sourceKey, types.SourceClient)
+	stats := newConnStats("Source "+sourceKey, health)
+
 	go func() {
 		_ = backoff.Retry(func() (error) {
 			var conn net.Conn
 			var err error
 			log.Infof("Opening connection for %s:%d", c.Host, c.Port)
-			if conn, err = openConnection(c.Host, c.Port); err != nil {
+			if conn, err = openConnection(c.Host, c.Port, health); err != nil {
 				log.Errorf("Couldn't open connection: %s", err.Error())
+				health.Backoff(err)
 				return err
 			}
-			handlerErr := handleConnection(conn, ac)
+			health.Connected()
+			handlerErr := handleConnection(conn, c.Format, c.recorder, stats, sbsOut, out)
+			health.Backoff(handlerErr)
 			return handlerErr
 		},
 			backoff.NewConstantBackOff(1*time.Second))
@@ -82,22 +123,26 @@ func (c *TCPClient) start(ac chan<- types.AircraftData) {
 	}()
 }
 
-func openConnection(host string, port int) (conn net.Conn, err error) {
+func openConnection(host string, port int, health *types.SourceHealth) (conn net.Conn, err error) {
 	var tcpAddr *net.TCPAddr
 
+	health.Connecting()
 	if tcpAddr, err = net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", host, port)); err != nil {
 		return nil, err
 	}
 
-	// TODO: Collect status of individual connections for UI feedback
-	err = backoff.Retry(func() (err error) {
+	err = backoff.RetryNotify(func() (err error) {
+		health.Connecting()
 		if conn, err = net.DialTCP("tcp", nil, tcpAddr); err != nil {
 			log.Error(err)
 			return err
 		}
 		return nil
 	},
-		backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5))
+		backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5),
+		func(err error, _ time.Duration) {
+			health.Backoff(err)
+		})
 
 	if err != nil {
 		log.Errorf("Retry failed: %s", err)
@@ -129,17 +174,53 @@ func Start(beastInfo *BeastInfo) {
 		log.Debugf("Beast Info: %v", beastInfo)
 	}
 
+	inputs := 0
+	if beastInfo.RtlInput || beastInfo.IQFile != "" || beastInfo.RtlTcp != "" {
+		inputs++
+	}
+
 	for _, source := range beastInfo.Sources {
-		if source.Host != "" && source.Port != 0 {
+		if source.File != "" {
+			inputs++
+			replay := &FileClient{
+				File:   source.File,
+				Format: source.Format,
+				Speed:  source.Speed,
+				Loop:   source.Loop,
+				Clock:  source.Clock,
+			}
+			replay.start(sbsMessages, frames)
+		} else if source.Host != "" && source.Port != 0 {
+			inputs++
 			sourceKey := fmt.Sprintf("%s:%d", source.Host, source.Port)
 			sources[sourceKey] = &TCPClient{
-				Host: source.Host,
-				Port: source.Port,
+				Host:     source.Host,
+				Port:     source.Port,
+				Format:   source.Format,
+				recorder: newRecorder(beastInfo, sourceKey, source.Format),
 			}
-			sources[sourceKey].start(aircraft)
+			sources[sourceKey].start(sbsMessages, frames)
+		}
+	}
+
+	if beastInfo.ListenPort != 0 {
+		inputs++
+		server := &TCPServer{Port: beastInfo.ListenPort, MaxFeeders: beastInfo.MaxFeeders}
+		if err := server.start(frames); err != nil {
+			log.Fatalf("Unable to accept feeders: %s", err)
 		}
 	}
 
+	// A single receiver has nothing to merge, so don't hold its messages back.
+	// Any number of feeders can connect unless only one is accepted.
+	severalReceivers := inputs > 1 || beastInfo.ListenPort != 0 && beastInfo.MaxFeeders != 1
+	window := beastInfo.DedupWindow
+	if !severalReceivers {
+		window = 0
+	}
+	go decodeFrames(frames, sbsMessages, aircraft, window)
+
+	filter := output.NewCategoryFilter(beastInfo)
 	outputs := make([]output.Output, len(beastInfo.Outputs))
 	for i, outtype := range beastInfo.Outputs {
 		switch outtype {
@@ -161,7 +242,7 @@ func Start(beastInfo *BeastInfo) {
 			for {
 				select {
 				case acm := <-l.C:
-					op.UpdateDisplay(acm.([]*types.AircraftData)) //.(*types.AircraftMap))
+					op.UpdateDisplay(filter.Visible(acm.([]*types.AircraftData))) //.(*types.AircraftMap))
 				case <-done.Listen().C:
 					return //Unnecessary?
 				}
@@ -196,13 +277,48 @@ func Start(beastInfo *BeastInfo) {
 
 	// RTL SDR Scanner
 	var scanner Scanner
+	var rtlTcpHealth *types.SourceHealth
+	receiver := "rtl"
 
-	if Info.RtlInput {
+	sampleRate := Info.SampleRate
+	if sampleRate == 0 {
+		sampleRate = input.DemodSampleRate
+	}
+	if (Info.RtlInput || Info.IQFile != "" || Info.RtlTcp != "") && !input.SampleRateSupported(sampleRate) {
+		log.Fatalf("Unable to demodulate at %d samples per second, use %d or at least %d",
+			sampleRate, input.DemodSampleRate, input.MinPhaseSampleRate)
+	}
 
-		scanner = input.NewRtlSdrScanner(dataBuffLen)
+	if Info.RtlInput {
+		scanner = input.NewRtlSdrScanner(sampleRate, dataBuffLen)
 		//defer scanner.Close()
+	} else if Info.IQFile != "" {
+		iqScanner, err := input.NewIQFileScanner(Info.IQFile, Info.IQFormat, Info.IQSampleRate, sampleRate, dataBuffLen)
+		if err != nil {
+			log.Fatalf("Unable to read IQ capture: %s", err)
+		}
+		iqScanner.Realtime = true
+		scanner = iqScanner
+		receiver = Info.IQFile
+	} else if Info.RtlTcp != "" {
+		tcpScanner, err := input.NewRtlTcpScanner(Info.RtlTcp, sampleRate, Info.RtlTcpGain, Info.RtlTcpPpm, dataBuffLen)
+		if err != nil {
+			log.Fatalf("Unable to connect to rtl_tcp: %s", err)
+		}
+		log.Infof("Connected to rtl_tcp at %s with %s tuner", Info.RtlTcp, tcpScanner.Dongle.TunerName())
+		rtlTcpHealth = types.DefaultSourceRegistry.Register(Info.RtlTcp, types.SourceClient)
+		rtlTcpHealth.Connected()
+		scanner = tcpScanner
+		receiver = Info.RtlTcp
+	}
 
-		demod := input.NewDemod()
+	if scanner != nil {
+		demod := input.NewDemod(0)
+		demod.ModeAC = Info.ModeAC
+		demod.SampleRate = sampleRate
+		if Info.ModeAC && sampleRate != input.DemodSampleRate {
+			log.Warnf("Mode A/C replies are only demodulated at %d samples per second", input.DemodSampleRate)
+		}
 		//var msgChs = make([]chan input.Message, 0)
 
 		go func() {
@@ -210,11 +326,34 @@ func Start(beastInfo *BeastInfo) {
 
 			for {
 				select {
-				case iq := <-ch:
-					go demod.DetectModeS(iq)
+				case iq, ok := <-ch:
+					if !ok {
+						switch ended := scanner.(type) {
+						case *input.IQFileScanner:
+							if err := ended.Error(); err != io.EOF {
+								log.Errorf("Unable to read IQ capture %s: %s", ended.Path, err)
+							} else {
+								log.Infof("End of IQ capture %s", ended.Path)
+							}
+						case *input.RtlTcpScanner:
+							// rtl_tcp hangs up when its dongle goes away or it restarts
+							log.Errorf("Lost rtl_tcp at %s: %s", ended.Addr, ended.Error())
+							rtlTcpHealth.Backoff(ended.Error())
+							ended.Close()
+							if reconnected := reconnectRtlTcp(sampleRate, dataBuffLen, rtlTcpHealth, done); reconnected != nil {
+								scanner = reconnected
+								ch = scanner.GetSourceIQCh()
+								continue
+							}
+						}
+						scanner.Close()
+						demod.Close()
+						return
+					}
+					demod.Process(iq)
 				case <-done.Listen().C:
-					demod.Close()
 					scanner.Close()
+					demod.Close()
 					return
 				}
 			}
@@ -222,15 +361,21 @@ func Start(beastInfo *BeastInfo) {
 
 		time.Sleep(2 * time.Millisecond)
 
+		// Drained until the demodulator is closed
 		go func() {
-			for {
-				select {
-				case msg := <-demod.MessageCh:
-					aircraft <- modes.DecodeModeS(msg.Msg, false, 0.0, knownAircraft, Info)
-				case <-done.Listen().C:
-					return
-
+			for msg := range demod.MessageCh {
+				frame := dedup.Message{Receiver: receiver}
+				frame.Signal = msg.SignalByte()
+				switch {
+				case msg.Type == input.TypeModeAC:
+					frame.Type = beast.TypeModeAC
+				case len(msg.Msg) == 7:
+					frame.Type = beast.TypeModeSShort
+				default:
+					frame.Type = beast.TypeModeSLong
 				}
+				frame.SetPayload(msg.Msg)
+				frames <- frame
 			}
 		}()
 
@@ -247,11 +392,9 @@ func Start(beastInfo *BeastInfo) {
 	for {
 		select {
 		case airframe := <-aircraft:
+			// The decoders store the aircraft as they go, the outputs are
+			// published from knownAircraft
 			log.Debugf("Received %x which is %t", airframe.IcaoAddr, airframe.IsValid)
-			if !airframe.IsValid {
-				continue
-			}
-			knownAircraft.Store(airframe.IcaoAddr, &airframe)
 			//TODO: mcast or something similar to stream consumers?
 		case <-done.Listen().C:
 			break loop
@@ -262,99 +405,206 @@ func Start(beastInfo *BeastInfo) {
 
 }
 
-func handleConnection(conn net.Conn, ac chan<- types.AircraftData) (err error) {
-	//reader := bufio.NewReaderSize(conn, 128)
-	reader := bufio.NewReader(conn)
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(ScanModeS)
-
+func handleConnection(conn net.Conn, format string, rec *record.Writer, stats *connStats, sbsOut chan<- sbsMessage, out chan<- dedup.Message) (err error) {
 	defer conn.Close()
 
-	for {
-		if ok := scanner.Scan(); !ok {
-			log.Errorf("Scanner has a problem...")
-			break
+	dog := startWatchdog(conn, stats.health, Info.SourceTimeout)
+	defer func() {
+		if dog.stop() {
+			err = errSilent
 		}
-		currentMessage := scanner.Bytes()
+	}()
 
-		// Connection closed
-		if len(currentMessage) == 0 {
-			continue
+	stream := &countingReader{r: conn, stats: stats}
+	if format == FORMAT_SBS {
+		return readSbs(stream, sbsOut, stats)
+	}
+
+	err = readFrames(newFrameReader(format, stream), out, nil, rec, stats)
+	log.Errorf("Frame reader error: %s", err)
+	return err
+}
+
+// readFrames passes frames on until the reader fails, optionally pacing them
+// for replay, recording them and counting them per connection
+// reconnectRtlTcp connects to Info.RtlTcp again, retrying every second, and
+// starts it. It returns nil once done is closed.
+func reconnectRtlTcp(sampleRate int, dataLen int, health *types.SourceHealth, done *multicast.Channel) *input.RtlTcpScanner {
+	for {
+		health.Connecting()
+		scanner, err := input.NewRtlTcpScanner(Info.RtlTcp, sampleRate, Info.RtlTcpGain, Info.RtlTcpPpm, dataLen)
+		if err == nil {
+			log.Infof("Reconnected to rtl_tcp at %s with %s tuner", Info.RtlTcp, scanner.Dongle.TunerName())
+			health.Connected()
+			scanner.Start()
+			return scanner
 		}
+		log.Errorf("Unable to reconnect to rtl_tcp: %s", err)
+		health.Backoff(err)
 
-		validMessage := false
-		if currentMessage[0] == 0x31 || currentMessage[0] == 0x32 ||
-			currentMessage[0] == 0x33 || currentMessage[0] == 0x34 {
-			validMessage = true
+		select {
+		case <-time.After(1 * time.Second):
+		case <-done.Listen().C:
+			return nil
 		}
-		if !validMessage {
+	}
+}
+
+func readFrames(reader frameReader, out chan<- dedup.Message, pace *pacer, rec *record.Writer, stats *connStats) error {
+	var buf []byte
+	receiver := ""
+	if stats != nil {
+		receiver = stats.receiver
+	}
+
+	for {
+		frame, err := reader.Next()
+		if isBadFrame(err) {
 			if Info.Debug {
-				log.Debugf("Not a valid Message with 0x31 32 33 34 Msg: %#x\n", currentMessage)
+				log.Debugf("Bad frame: %s", err)
+			}
+			BadRate.Mark(1)
+			if stats != nil {
+				stats.bad()
 			}
 			continue
+		} else if err != nil {
+			return err
+		}
+
+		if pace != nil {
+			pace.wait(frame.Timestamp)
+		}
+
+		if rec != nil {
+			if buf, err = recordFrame(rec, frame, buf); err != nil {
+				log.Errorf("Recording failed: %s", err)
+				rec = nil
+			}
+		}
+
+		if frame.Type == beast.TypeModeSShort || frame.Type == beast.TypeModeSLong {
+			if !checkCRC(frame, stats) {
+				continue
+			}
+		}
+
+		if stats != nil {
+			stats.good()
 		}
 
-		msgType := currentMessage[0]
-		var msgLen int
+		out <- dedup.Message{Frame: *frame, Receiver: receiver}
+	}
+}
+
+// checkCRC corrects the bad bits of a Mode S frame that the CRC allows and
+// reports whether it is fit to decode. Recordings keep the frame as received.
+func checkCRC(frame *beast.Frame, stats *connStats) bool {
+	payload := frame.Payload()
+	fixed, ok := modes.FixCRC(payload, Info.CRCFix)
+	if !ok {
+		if Info.Debug {
+			log.Debugf("CRC failed: %x", payload)
+		}
+		CRCFailedCnt.Inc(1)
+		BadRate.Mark(1)
+		if stats != nil {
+			stats.Failed.Inc(1)
+			stats.bad()
+		}
+		return false
+	}
+
+	if fixed > 0 {
+		if Info.Debug {
+			log.Debugf("CRC fixed %d bits: %x", fixed, payload)
+		}
+		CRCFixedCnt.Inc(1)
+		if stats != nil {
+			stats.Fixed.Inc(1)
+		}
+	}
+	return true
+}
 
+// decodeFrames merges the copies of each message heard by several receivers and
+// decodes what is left
+func decodeFrames(in <-chan dedup.Message, sbsIn <-chan sbsMessage, ac chan<- types.AircraftData, window time.Duration) {
+	filter := dedup.NewFilter(window)
+	tracker := modes.NewTracker(knownAircraft, Info)
+
+	decode := func(msg dedup.Message) {
 		// http://wiki.modesbeast.com/Mode-S_Beast:Data_Output_Formats
-		switch msgType {
-		case 0x31: // 1 - Mode A/C
+		switch msg.Type {
+		case beast.TypeModeAC:
 			ModeACCnt.Inc(1)
-			msgLen = 10
-		case 0x32: // 2 - Mode S Short
+		case beast.TypeModeSShort:
 			ModesShortCnt.Inc(1)
-			msgLen = 15
-		case 0x33: // 3 - Mode S Long
+		case beast.TypeModeSLong:
 			ModesLongCnt.Inc(1)
-			msgLen = 22
-		case 0x34: // 4
-			if (Info.Debug) {
-				log.Debugf("Invalid Beast mode msg type 4: %x", currentMessage)
-			}
-			continue // not supported
-		default:
-			continue
-			//msgLen = 8 // shortest possible msg w/header & timetstamp
 		}
+		GoodRate.Mark(1)
 
-		if len(currentMessage) == msgLen {
-			GoodRate.Mark(1)
+		if msg.Type == beast.TypeModeAC {
+			ac <- tracker.DecodeModeAC(msg.Payload(), msg.IsMlat(), msg.Receivers)
 		} else {
-			BadRate.Mark(1)
-			continue
+			ac <- tracker.Decode(msg.Payload(), msg.IsMlat(), msg.Receivers)
 		}
+	}
 
-		isMlat := bytes.Equal(currentMessage[1:7], magicTimestampMLAT)
+	var flush <-chan time.Time
+	if window > 0 {
+		ticker := time.NewTicker(window / 4)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
 
-		if msgType == 0x31 {
-			ac <- modes.DecodeModeAC(currentMessage[8:], isMlat, 10*math.Log10(math.Pow(float64(currentMessage[7])/255, 2)), knownAircraft, Info)
-		} else {
-			ac <- modes.DecodeModeS(currentMessage[8:], isMlat, 10*math.Log10(math.Pow(float64(currentMessage[7])/255, 2)), knownAircraft, Info)
+	for {
+		select {
+		case msg := <-in:
+			if filter.Add(msg, time.Now(), decode) {
+				DupRate.Mark(1)
+			}
+		case now := <-flush:
+			filter.Flush(now, decode)
+		case msg := <-sbsIn:
+			ac <- tracker.UpdateSbs(msg.Message, msg.Receiver)
 		}
 	}
+}
 
-	if scanner.Err() != nil {
-		log.Errorf("Scanner Error: %s\n", scanner.Err())
-		return scanner.Err()
-	}
+func readSbs(r io.Reader, out chan<- sbsMessage, stats *connStats) error {
+	scanner := bufio.NewScanner(r)
 
-	return errors.New("scanner ended normally")
-}
+	for scanner.Scan() {
+		msg, err := sbs.Parse(scanner.Text())
+		if err == sbs.ErrNotMsg {
+			// STA, AIR, ID, SEL and CLK records carry nothing we track
+			continue
+		} else if err != nil {
+			if Info.Debug {
+				log.Debugf("Bad SBS record: %s", scanner.Text())
+			}
+			BadRate.Mark(1)
+			if stats != nil {
+				stats.bad()
+			}
+			continue
+		}
+		GoodRate.Mark(1)
+		receiver := ""
+		if stats != nil {
+			stats.good()
+			receiver = stats.receiver
+		}
 
-func ScanModeS(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		log.Warn("Splitter detected EOF AND len(data)==0")
-		return 0, nil, bufio.ErrFinalToken
-	}
-	if i := bytes.IndexByte(data, 0x1a); i >= 0 {
-		return i + 1, data[0:i], nil
+		out <- sbsMessage{Message: msg, Receiver: receiver}
 	}
-	// If we're at EOF, we have a final, non-terminated line. Return it.
-	if atEOF {
-		log.Warn("Splitter detected EOF but has data")
-		return len(data), data, bufio.ErrFinalToken
+
+	if scanner.Err() != nil {
+		log.Errorf("SBS reader error: %s", scanner.Err())
+		return scanner.Err()
 	}
-	// Request more data.
-	return 0, nil, nil
+
+	return io.EOF
 }
@@ -0,0 +1,127 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ccustine/beastie/types"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+var errSilent = errors.New("no frames received, reconnecting")
+
+// connStats counts the traffic of a single source, both as rates in the default
+// metrics registry and in its health
+type connStats struct {
+	Good     metrics.Meter
+	Bad      metrics.Meter
+	Fixed    metrics.Counter // Messages corrected by the CRC
+	Failed   metrics.Counter // Messages dropped by the CRC
+	Bytes    metrics.Counter
+	health   *types.SourceHealth
+	receiver string // Tags the frames of the source
+	names    []string
+}
+
+func newConnStats(prefix string, health *types.SourceHealth) *connStats {
+	s := &connStats{health: health, receiver: health.Status().Name}
+	s.Good = metrics.GetOrRegisterMeter(s.name(prefix, "Message Rate (Good)"), metrics.DefaultRegistry)
+	s.Bad = metrics.GetOrRegisterMeter(s.name(prefix, "Message Rate (Bad)"), metrics.DefaultRegistry)
+	s.Fixed = metrics.GetOrRegisterCounter(s.name(prefix, "CRC (Fixed)"), metrics.DefaultRegistry)
+	s.Failed = metrics.GetOrRegisterCounter(s.name(prefix, "CRC (Failed)"), metrics.DefaultRegistry)
+	s.Bytes = metrics.GetOrRegisterCounter(s.name(prefix, "Bytes"), metrics.DefaultRegistry)
+	return s
+}
+
+func (s *connStats) name(prefix string, metric string) string {
+	name := fmt.Sprintf("%s %s", prefix, metric)
+	s.names = append(s.names, name)
+	return name
+}
+
+func (s *connStats) good() {
+	s.Good.Mark(1)
+	s.health.Frame()
+}
+
+func (s *connStats) bad() {
+	s.Bad.Mark(1)
+}
+
+func (s *connStats) unregister() {
+	for _, name := range s.names {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+}
+
+// countingReader counts every byte read from a source
+type countingReader struct {
+	r     io.Reader
+	stats *connStats
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.stats.Bytes.Inc(int64(n))
+	c.stats.health.AddBytes(n)
+	return n, err
+}
+
+// watchdog closes a connection that stays open without delivering frames, so
+// that the read fails and the source is reconnected
+type watchdog struct {
+	done  chan struct{}
+	fired int32
+}
+
+// startWatchdog watches health until stopped. A timeout of 0 disables it.
+func startWatchdog(conn io.Closer, health *types.SourceHealth, timeout time.Duration) *watchdog {
+	w := &watchdog{done: make(chan struct{})}
+	if timeout <= 0 {
+		return w
+	}
+
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if idle := health.Idle(); idle > timeout {
+					log.Warnf("No frames from %s for %s, reconnecting", health.Status().Name, idle.Round(time.Second))
+					atomic.StoreInt32(&w.fired, 1)
+					conn.Close()
+					return
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return w
+}
+
+// stop ends the watch and reports whether the watchdog closed the connection
+func (w *watchdog) stop() bool {
+	close(w.done)
+	return atomic.LoadInt32(&w.fired) == 1
+}
@@ -0,0 +1,163 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ccustine/beastie/beast"
+	. "github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/record"
+	"github.com/ccustine/beastie/types"
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	recorders     []*record.Writer
+	recordersLock sync.Mutex
+
+	// Zero of the timestamps given to recorded frames that have none
+	recordEpoch = time.Now()
+)
+
+// wallClock returns now as a 12 MHz counter from recordEpoch, like the
+// timestamps of Beast receivers. It is never 0, which is no timestamp.
+func wallClock(now time.Time) uint64 {
+	return (1 + uint64(now.Sub(recordEpoch))*12/1000) & (1<<48 - 1)
+}
+
+// newRecorder returns a recorder for the source, or nil if recording is disabled
+// or the source is not framed. AVR sources are recorded as Beast.
+func newRecorder(info *BeastInfo, sourceKey string, format string) *record.Writer {
+	if info.RecordDir == "" || format == FORMAT_SBS {
+		return nil
+	}
+
+	rec, err := record.NewWriter(sourceKey, FORMAT_BEAST, record.Options{
+		Dir:      info.RecordDir,
+		MaxSize:  info.RecordMaxSize,
+		MaxAge:   info.RecordMaxAge,
+		Compress: info.RecordCompress,
+	})
+	if err != nil {
+		log.Errorf("Unable to record %s: %s", sourceKey, err)
+		return nil
+	}
+
+	recordersLock.Lock()
+	recorders = append(recorders, rec)
+	recordersLock.Unlock()
+
+	return rec
+}
+
+// CloseRecorders flushes and closes every open recording. It must be called
+// before exiting or compressed recordings will be truncated.
+func CloseRecorders() {
+	recordersLock.Lock()
+	defer recordersLock.Unlock()
+
+	for _, rec := range recorders {
+		if err := rec.Close(); err != nil {
+			log.Errorf("Error closing recording: %s", err)
+		}
+	}
+	recorders = nil
+}
+
+// Record writes the raw frames of every network source to disk without decoding
+// them, until stop is closed.
+func Record(beastInfo *BeastInfo, stop <-chan struct{}) {
+	Info = beastInfo
+
+	for _, source := range beastInfo.Sources {
+		if source.Host == "" || source.Port == 0 {
+			continue
+		}
+		sourceKey := fmt.Sprintf("%s:%d", source.Host, source.Port)
+		rec := newRecorder(beastInfo, sourceKey, source.Format)
+		if rec == nil {
+			continue
+		}
+
+		health := types.DefaultSourceRegistry.Register(sourceKey, types.SourceClient)
+		stats := newConnStats("Source "+sourceKey, health)
+
+		go func(source Source, rec *record.Writer) {
+			_ = backoff.Retry(func() error {
+				var conn net.Conn
+				var err error
+				log.Infof("Recording %s:%d to %s", source.Host, source.Port, beastInfo.RecordDir)
+				if conn, err = openConnection(source.Host, source.Port, health); err != nil {
+					log.Errorf("Couldn't open connection: %s", err.Error())
+					health.Backoff(err)
+					return err
+				}
+				defer conn.Close()
+				health.Connected()
+
+				dog := startWatchdog(conn, health, beastInfo.SourceTimeout)
+				err = recordFrames(newFrameReader(source.Format, &countingReader{r: conn, stats: stats}), rec, stats)
+				if dog.stop() {
+					err = errSilent
+				}
+				log.Errorf("Recording of %s interrupted: %s", sourceKey, err)
+				health.Backoff(err)
+				return err
+			},
+				backoff.NewConstantBackOff(1*time.Second))
+		}(source, rec)
+	}
+
+	<-stop
+	CloseRecorders()
+}
+
+func recordFrames(reader frameReader, rec *record.Writer, stats *connStats) error {
+	var buf []byte
+	for {
+		frame, err := reader.Next()
+		if isBadFrame(err) {
+			BadRate.Mark(1)
+			stats.bad()
+			continue
+		} else if err != nil {
+			return err
+		}
+		GoodRate.Mark(1)
+		stats.good()
+
+		if buf, err = recordFrame(rec, frame, buf); err != nil {
+			return err
+		}
+	}
+}
+
+// recordFrame writes frame to rec as Beast, reusing buf. Frames without a
+// receiver timestamp, as from AVR sources, are recorded with the time they
+// arrived so their replay is paced.
+func recordFrame(rec *record.Writer, frame *beast.Frame, buf []byte) ([]byte, error) {
+	recorded := *frame
+	if recorded.Timestamp == 0 {
+		recorded.Timestamp = wallClock(time.Now())
+	}
+	buf = recorded.AppendBeast(buf[:0])
+	_, err := rec.Write(buf)
+	return buf, err
+}
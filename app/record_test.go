@@ -0,0 +1,86 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/dedup"
+	"github.com/ccustine/beastie/record"
+	"github.com/ccustine/beastie/types"
+)
+
+func TestRecordReplay_AVR(t *testing.T) {
+	Info = &BeastInfo{}
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// AVR frames carry no timestamp, the recorder gives them their arrival
+	const gap = 200 * time.Millisecond
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, "*8D4840D6202CC371C32CE0576098;\n")
+		time.Sleep(gap)
+		io.WriteString(w, "*8D4840D6202CC371C32CE0576098;\n")
+		w.Close()
+	}()
+
+	rec, err := record.NewWriter("avr:30002", FORMAT_BEAST, record.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := types.NewSourceRegistry()
+	stats := newConnStats("Test AVR", registry.Register("avr:30002", types.SourceClient))
+	defer stats.unregister()
+	if err := recordFrames(newFrameReader(FORMAT_AVR, r), rec, stats); err != io.EOF {
+		t.Fatalf("recordFrames() error = %v, want %v", err, io.EOF)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "avr_30002-*"))
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+
+	out := make(chan dedup.Message, 2)
+	replay := &FileClient{File: files[0], Speed: 1}
+	start := time.Now()
+	if err := replay.replay(nil, out, stats); err != io.EOF {
+		t.Fatalf("replay() error = %v, want %v", err, io.EOF)
+	}
+	if elapsed := time.Since(start); elapsed < gap/2 {
+		t.Errorf("replay() took %s, want about %s", elapsed, gap)
+	}
+
+	close(out)
+	var timestamps []uint64
+	for msg := range out {
+		timestamps = append(timestamps, msg.Timestamp)
+	}
+	if len(timestamps) != 2 || timestamps[0] == 0 || timestamps[1] <= timestamps[0] {
+		t.Errorf("replayed timestamps %v, want 2 increasing", timestamps)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/ccustine/beastie/beast"
+	. "github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/dedup"
+	"github.com/ccustine/beastie/record"
+	"github.com/ccustine/beastie/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// A jump in stream time larger than this (receiver restart, concatenated
+	// captures) restarts pacing instead of stalling the replay
+	maxReplayGap = uint64(10 * time.Minute)
+	// Tolerated backwards jitter from interleaved sources
+	maxReplayJitter = uint64(time.Second)
+)
+
+// FileClient replays a recorded Beast or AVR stream as if it came from a live
+// source. Files written by the recorder may be gzip or zstd compressed, and
+// have their format in the header; Format is that of other files. Frames are
+// paced by their receiver timestamps, which the recorder adds to frames that
+// have none, so only SBS files and AVR captures of other programs without
+// timestamps replay as fast as possible.
+type FileClient struct {
+	File   string
+	Format string
+	Speed  float64 // 1 is real time, 0 is as fast as possible
+	Loop   bool
+	Clock  string
+}
+
+func (c *FileClient) start(sbsOut chan<- sbsMessage, out chan<- dedup.Message) {
+	health := types.DefaultSourceRegistry.Register(c.File, types.SourceReplay)
+	stats := newConnStats("Replay "+c.File, health)
+
+	go func() {
+		for {
+			log.Infof("Replaying %s at %.1fx", c.File, c.Speed)
+			health.Connected()
+			err := c.replay(sbsOut, out, stats)
+			if err != io.EOF {
+				log.Errorf("Replay of %s failed: %s", c.File, err)
+				health.Failed(err)
+				return
+			}
+			if !c.Loop {
+				log.Infof("Replay of %s finished", c.File)
+				types.DefaultSourceRegistry.Unregister(c.File)
+				stats.unregister()
+				return
+			}
+		}
+	}()
+}
+
+func (c *FileClient) replay(sbsOut chan<- sbsMessage, out chan<- dedup.Message, stats *connStats) error {
+	file, err := os.Open(c.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stream, header, err := record.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	format := c.Format
+	if header != nil {
+		log.Infof("Replaying %s recorded from %s at %s", c.File, header.Source, header.Start)
+		format = header.Format
+	}
+
+	if format == FORMAT_SBS {
+		// BaseStation records carry no receiver timestamp, so they are not paced
+		return readSbs(stream, sbsOut, stats)
+	}
+
+	return readFrames(newFrameReader(format, stream), out, &pacer{speed: c.Speed, clock: c.Clock}, nil, stats)
+}
+
+// pacer delays frames so they are delivered at the rate they were received
+type pacer struct {
+	speed   float64
+	clock   string
+	base    uint64 // stream time of the first paced frame in ns
+	last    uint64
+	started time.Time
+}
+
+// wait sleeps until the frame with timestamp is due. Frames without a
+// timestamp, and MLAT results, are passed on at once.
+func (p *pacer) wait(timestamp uint64) {
+	if p.speed <= 0 || timestamp == 0 || timestamp == beast.MlatTimestamp {
+		return
+	}
+
+	now := p.streamTime(timestamp)
+	if p.started.IsZero() || now+maxReplayJitter < p.last || now > p.last+maxReplayGap {
+		p.base = now
+		p.last = now
+		p.started = time.Now()
+		return
+	}
+	if now < p.last {
+		return
+	}
+	p.last = now
+
+	due := p.started.Add(time.Duration(float64(now-p.base) / p.speed))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// streamTime converts a frame timestamp to nanoseconds
+func (p *pacer) streamTime(timestamp uint64) uint64 {
+	if p.clock == CLOCK_GPS {
+		// 18 bit seconds of day | 30 bit nanoseconds
+		// http://wiki.modesbeast.com/Radarcape:Firmware_Versions#The_GPS_timestamp
+		return (timestamp>>30)*uint64(time.Second) + timestamp&(1<<30-1)
+	}
+	// 12 MHz counter
+	return timestamp * 1000 / 12
+}
@@ -0,0 +1,43 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/ccustine/beastie/config"
+)
+
+func TestPacer_streamTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		clock     string
+		timestamp uint64
+		want      uint64
+	}{
+		{"12 MHz", CLOCK_12MHZ, 12000000, uint64(time.Second)},
+		{"default", "", 18, 1500},
+		{"gps", CLOCK_GPS, 3600<<30 | 250000000, uint64(time.Hour + 250*time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pacer{clock: tt.clock}
+			if got := p.streamTime(tt.timestamp); got != tt.want {
+				t.Errorf("streamTime() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
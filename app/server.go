@@ -0,0 +1,138 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/dedup"
+	"github.com/ccustine/beastie/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// TCPServer accepts Beast streams pushed by remote feeders, for receivers that
+// cannot be reached directly (like dump1090 --net-bi-port).
+type TCPServer struct {
+	Port       int
+	MaxFeeders int // 0 for no limit
+
+	sync.Mutex
+	feeders map[string]*feeder
+}
+
+// feeder is a single inbound connection, identified by its remote host
+type feeder struct {
+	ID        string
+	Addr      string
+	Connected time.Time
+	stats     *connStats
+}
+
+func (s *TCPServer) start(out chan<- dedup.Message) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
+	if err != nil {
+		return err
+	}
+	s.feeders = make(map[string]*feeder)
+	log.Infof("Accepting Beast feeders on port %d", s.Port)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					time.Sleep(100 * time.Millisecond)
+					continue
+				}
+				log.Errorf("Feeder listener failed: %s", err)
+				return
+			}
+
+			f := s.add(conn)
+			if f == nil {
+				log.Warnf("Rejected feeder %s, limit of %d reached", conn.RemoteAddr(), s.MaxFeeders)
+				conn.Close()
+				continue
+			}
+			go s.serve(conn, f, out)
+		}
+	}()
+
+	return nil
+}
+
+// add registers a new connection, or returns nil if the feeder limit is reached
+func (s *TCPServer) add(conn net.Conn) *feeder {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.MaxFeeders > 0 && len(s.feeders) >= s.MaxFeeders {
+		return nil
+	}
+
+	// Feeders are known by host so their identity survives reconnects, unless
+	// several feed from behind the same address
+	addr := conn.RemoteAddr().String()
+	id, _, err := net.SplitHostPort(addr)
+	if _, taken := s.feeders[id]; taken || err != nil {
+		id = addr
+	}
+
+	health := types.DefaultSourceRegistry.Register(id, types.SourceFeeder)
+	f := &feeder{ID: id, Addr: addr, Connected: time.Now(), stats: newConnStats("Feeder "+id, health)}
+	s.feeders[id] = f
+	return f
+}
+
+func (s *TCPServer) remove(f *feeder) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.feeders, f.ID)
+	f.stats.unregister()
+	if f.ID == f.Addr {
+		// Not a stable identity, it will never be seen again
+		types.DefaultSourceRegistry.Unregister(f.ID)
+	}
+}
+
+func (s *TCPServer) serve(conn net.Conn, f *feeder, out chan<- dedup.Message) {
+	defer conn.Close()
+	defer s.remove(f)
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(10 * time.Second)
+	}
+
+	log.Infof("Feeder %s connected from %s", f.ID, f.Addr)
+	f.stats.health.Connected()
+
+	dog := startWatchdog(conn, f.stats.health, Info.SourceTimeout)
+	reader := newFrameReader(FORMAT_BEAST, &countingReader{r: conn, stats: f.stats})
+	err := readFrames(reader, out, nil, nil, f.stats)
+	if dog.stop() {
+		err = errSilent
+	}
+	// Feeders reconnect on their own
+	f.stats.health.Backoff(err)
+	log.Infof("Feeder %s disconnected after %s (%d good, %d bad, %d bytes): %s",
+		f.ID, time.Since(f.Connected).Round(time.Second),
+		f.stats.Good.Count(), f.stats.Bad.Count(), f.stats.Bytes.Count(), err)
+}
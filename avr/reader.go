@@ -0,0 +1,182 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package avr reads the AVR raw text format emitted by dump1090 on port 30002
+// and by serial Mode-S receivers. Three variants are understood:
+//
+//	*8d4840d6202cc371c32ce0576098;                    plain message
+//	@016ce3671c9a8d4840d6202cc371c32ce0576098;        12 MHz timestamp, message
+//	%016ce3671c9ac88d4840d6202cc371c32ce0576098;      12 MHz timestamp, signal level, message
+//
+// Messages are returned as Beast frames so they can share the Beast decoding path.
+package avr
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/ccustine/beastie/beast"
+)
+
+var (
+	ErrBadLine = errors.New("avr: malformed line")
+)
+
+type Reader struct {
+	br    *bufio.Reader
+	frame beast.Frame
+	msg   [beast.MaxPayload]byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{br: br}
+}
+
+// Next returns the next message in the stream. The returned frame is only valid
+// until the following call to Next. ErrBadLine is not fatal and the caller may
+// keep reading; any other error comes from the underlying reader.
+func (r *Reader) Next() (*beast.Frame, error) {
+	for {
+		line, err := r.br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Not AVR, drop the rest of the line
+			for err == bufio.ErrBufferFull {
+				_, err = r.br.ReadSlice('\n')
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrBadLine
+		}
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line = trimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if err := r.parseLine(line); err != nil {
+			return nil, err
+		}
+		return &r.frame, nil
+	}
+}
+
+func (r *Reader) parseLine(line []byte) error {
+	if len(line) < 2 || line[len(line)-1] != ';' {
+		return ErrBadLine
+	}
+	marker := line[0]
+	body := line[1 : len(line)-1]
+
+	r.frame.Timestamp = 0
+	r.frame.Signal = 0
+
+	switch marker {
+	case '*':
+	case '@', '%':
+		if len(body) < 12 {
+			return ErrBadLine
+		}
+		ts, ok := parseHex(body[:12])
+		if !ok {
+			return ErrBadLine
+		}
+		r.frame.Timestamp = ts
+		body = body[12:]
+
+		if marker == '%' {
+			if len(body) < 2 {
+				return ErrBadLine
+			}
+			sig, ok := parseHex(body[:2])
+			if !ok {
+				return ErrBadLine
+			}
+			r.frame.Signal = byte(sig)
+			body = body[2:]
+		}
+	default:
+		return ErrBadLine
+	}
+
+	if len(body)%2 != 0 || len(body)/2 > len(r.msg) {
+		return ErrBadLine
+	}
+	n := len(body) / 2
+	for i := 0; i < n; i++ {
+		b, ok := parseHex(body[i*2 : i*2+2])
+		if !ok {
+			return ErrBadLine
+		}
+		r.msg[i] = byte(b)
+	}
+
+	switch n {
+	case beast.PayloadLen(beast.TypeModeAC):
+		r.frame.Type = beast.TypeModeAC
+	case beast.PayloadLen(beast.TypeModeSShort):
+		r.frame.Type = beast.TypeModeSShort
+	case beast.PayloadLen(beast.TypeModeSLong):
+		r.frame.Type = beast.TypeModeSLong
+	default:
+		return ErrBadLine
+	}
+	r.frame.SetPayload(r.msg[:n])
+
+	return nil
+}
+
+func parseHex(digits []byte) (uint64, bool) {
+	var v uint64
+	for _, c := range digits {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		v = v<<4 | uint64(c)
+	}
+	return v, true
+}
+
+func trimSpace(line []byte) []byte {
+	for len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		line = line[1:]
+	}
+	for len(line) > 0 {
+		switch line[len(line)-1] {
+		case '\n', '\r', ' ', '\t':
+			line = line[:len(line)-1]
+			continue
+		}
+		break
+	}
+	return line
+}
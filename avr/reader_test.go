@@ -0,0 +1,95 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avr
+
+import (
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ccustine/beastie/beast"
+)
+
+func TestReader_Next(t *testing.T) {
+	type result struct {
+		Type      byte
+		Timestamp uint64
+		Signal    byte
+		Payload   string
+		Err       error
+	}
+	tests := []struct {
+		name   string
+		stream string
+		want   []result
+	}{
+		{
+			name:   "Plain",
+			stream: "*8D4840D6202CC371C32CE0576098;\r\n*5d4840d6202cc3;\n",
+			want: []result{
+				{beast.TypeModeSLong, 0, 0, "8d4840d6202cc371c32ce0576098", nil},
+				{beast.TypeModeSShort, 0, 0, "5d4840d6202cc3", nil},
+			},
+		},
+		{
+			name:   "MLAT timestamp",
+			stream: "@016CE3671C9A8D4840D6202CC371C32CE0576098;\n",
+			want:   []result{{beast.TypeModeSLong, 0x016ce3671c9a, 0, "8d4840d6202cc371c32ce0576098", nil}},
+		},
+		{
+			name:   "Timestamp and signal",
+			stream: "%016CE3671C9AC85D4840D6202CC3;\n",
+			want:   []result{{beast.TypeModeSShort, 0x016ce3671c9a, 0xc8, "5d4840d6202cc3", nil}},
+		},
+		{
+			name:   "Mode A/C",
+			stream: "*1234;\n",
+			want:   []result{{beast.TypeModeAC, 0, 0, "1234", nil}},
+		},
+		{
+			name:   "Malformed lines",
+			stream: "*5d4840d6202cc3\n*5d48a;\n#5d4840d6202cc3;\n*5d4840d6202cxx;\n\n*5d4840d6202cc3;",
+			want: []result{
+				{Err: ErrBadLine},
+				{Err: ErrBadLine},
+				{Err: ErrBadLine},
+				{Err: ErrBadLine},
+				{beast.TypeModeSShort, 0, 0, "5d4840d6202cc3", nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []result
+			r := NewReader(strings.NewReader(tt.stream))
+			for {
+				f, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					got = append(got, result{Err: err})
+					continue
+				}
+				got = append(got, result{f.Type, f.Timestamp, f.Signal, hex.EncodeToString(f.Payload()), nil})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next() = \ngot:  %+v\nwant: %+v", got, tt.want)
+			}
+		})
+	}
+}
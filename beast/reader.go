@@ -0,0 +1,210 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package beast implements framing for the Mode-S Beast binary protocol.
+// http://wiki.modesbeast.com/Mode-S_Beast:Data_Output_Formats
+package beast
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	Esc = 0x1a
+
+	TypeModeAC     = '1'
+	TypeModeSShort = '2'
+	TypeModeSLong  = '3'
+	TypeStatus     = '4'
+
+	TimestampLen = 6
+	MaxPayload   = 14
+
+	// MlatTimestamp is the magic timestamp ("\xFF\x00MLAT") mlat-server puts on synthesized messages
+	MlatTimestamp = uint64(0xFF004D4C4154)
+)
+
+var (
+	ErrShortFrame  = errors.New("beast: frame truncated by sync byte")
+	ErrUnknownType = errors.New("beast: unknown frame type")
+)
+
+// Frame is a single decoded Beast frame. The payload is stored inline so frames
+// can be copied by value without allocating.
+type Frame struct {
+	Type      byte
+	Timestamp uint64 // 48 bit 12 MHz counter
+	Signal    byte
+	data      [MaxPayload]byte
+	n         int
+}
+
+// Payload returns the Mode-S or Mode A/C bytes of the frame.
+func (f *Frame) Payload() []byte {
+	return f.data[:f.n]
+}
+
+// SetPayload stores msg as the frame payload. It is used by readers of other
+// formats that produce Beast frames.
+func (f *Frame) SetPayload(msg []byte) {
+	f.n = copy(f.data[:], msg)
+}
+
+// IsMlat reports whether the frame carries the mlat-server magic timestamp.
+func (f *Frame) IsMlat() bool {
+	return f.Timestamp == MlatTimestamp
+}
+
+// Rssi returns the signal level in dBFS.
+func (f *Frame) Rssi() float64 {
+	return 10 * math.Log10(math.Pow(float64(f.Signal)/255, 2))
+}
+
+// AppendBeast appends the frame to dst in Beast wire format, escaping any 0x1a bytes.
+func (f *Frame) AppendBeast(dst []byte) []byte {
+	dst = append(dst, Esc, f.Type)
+	for shift := uint(40); ; shift -= 8 {
+		dst = appendEscaped(dst, byte(f.Timestamp>>shift))
+		if shift == 0 {
+			break
+		}
+	}
+	dst = appendEscaped(dst, f.Signal)
+	for _, b := range f.Payload() {
+		dst = appendEscaped(dst, b)
+	}
+	return dst
+}
+
+func appendEscaped(dst []byte, b byte) []byte {
+	if b == Esc {
+		return append(dst, Esc, Esc)
+	}
+	return append(dst, b)
+}
+
+// PayloadLen returns the payload length for a frame type, or 0 if the type is not a message.
+func PayloadLen(frameType byte) int {
+	switch frameType {
+	case TypeModeAC:
+		return 2
+	case TypeModeSShort:
+		return 7
+	case TypeModeSLong:
+		return 14
+	}
+	return 0
+}
+
+// Reader splits a Beast byte stream into frames, undoing the 0x1a 0x1a escapes
+// found in timestamps, signal levels and payloads.
+type Reader struct {
+	br     *bufio.Reader
+	frame  Frame
+	synced bool // the sync byte for the next frame has already been consumed
+	body   [TimestampLen + 1 + MaxPayload]byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{br: br}
+}
+
+// Next returns the next frame in the stream. The returned frame is only valid
+// until the following call to Next. ErrShortFrame and ErrUnknownType are not
+// fatal and the caller may keep reading; any other error comes from the
+// underlying reader. Status frames are skipped.
+func (r *Reader) Next() (*Frame, error) {
+	for {
+		if !r.synced {
+			if err := r.sync(); err != nil {
+				return nil, err
+			}
+		}
+		r.synced = false
+
+		frameType, err := r.br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch frameType {
+		case Esc:
+			// Escaped 0x1a inside a frame we joined half way through, keep hunting
+			continue
+		case TypeStatus:
+			continue
+		}
+
+		n := PayloadLen(frameType)
+		if n == 0 {
+			return nil, ErrUnknownType
+		}
+
+		if err := r.readBody(TimestampLen + 1 + n); err != nil {
+			return nil, err
+		}
+
+		b := r.body[:]
+		r.frame.Type = frameType
+		r.frame.Timestamp = uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 |
+			uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+		r.frame.Signal = b[6]
+		r.frame.n = copy(r.frame.data[:], b[TimestampLen+1:TimestampLen+1+n])
+
+		return &r.frame, nil
+	}
+}
+
+// sync discards bytes until a frame start is found
+func (r *Reader) sync() error {
+	for {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == Esc {
+			return nil
+		}
+	}
+}
+
+func (r *Reader) readBody(n int) error {
+	for i := 0; i < n; i++ {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == Esc {
+			next, err := r.br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if next != Esc {
+				// A lone sync byte starts a new frame, so this one is truncated
+				_ = r.br.UnreadByte()
+				r.synced = true
+				return ErrShortFrame
+			}
+		}
+		r.body[i] = b
+	}
+	return nil
+}
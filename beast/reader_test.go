@@ -0,0 +1,137 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beast
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type result struct {
+	Type      byte
+	Timestamp uint64
+	Signal    byte
+	Payload   string
+	Err       error
+}
+
+func readAll(stream []byte) []result {
+	var results []result
+	r := NewReader(bytes.NewReader(stream))
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return results
+		}
+		if err != nil {
+			results = append(results, result{Err: err})
+			continue
+		}
+		results = append(results, result{f.Type, f.Timestamp, f.Signal, hex.EncodeToString(f.Payload()), nil})
+	}
+}
+
+func TestReader_Next(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []result
+	}{
+		{
+			name:   "Long frame",
+			stream: "1a33" + "01020304050607" + "8dad73a999117b9b8004285d1c83",
+			want:   []result{{TypeModeSLong, 0x010203040506, 0x07, "8dad73a999117b9b8004285d1c83", nil}},
+		},
+		{
+			name:   "Short and Mode A/C frames",
+			stream: "1a32" + "00000000000aff" + "5d4840d6202cc3" + "1a31" + "00000000000b80" + "1234",
+			want: []result{
+				{TypeModeSShort, 0x0a, 0xff, "5d4840d6202cc3", nil},
+				{TypeModeAC, 0x0b, 0x80, "1234", nil},
+			},
+		},
+		{
+			name:   "Escaped timestamp signal and payload",
+			stream: "1a32" + "00001a1a00001a1a" + "1a1a" + "5d1a1a40d6202cc3",
+			want:   []result{{TypeModeSShort, 0x00001a00001a, 0x1a, "5d1a40d6202cc3", nil}},
+		},
+		{
+			name:   "Truncated frame resyncs on next frame",
+			stream: "1a33" + "000000000001ff" + "8dad73" + "1a32" + "00000000000aff" + "5d4840d6202cc3",
+			want: []result{
+				{Err: ErrShortFrame},
+				{TypeModeSShort, 0x0a, 0xff, "5d4840d6202cc3", nil},
+			},
+		},
+		{
+			name:   "Leading garbage and escaped sync are skipped",
+			stream: "0102" + "1a1a" + "03" + "1a32" + "00000000000aff" + "5d4840d6202cc3",
+			want:   []result{{TypeModeSShort, 0x0a, 0xff, "5d4840d6202cc3", nil}},
+		},
+		{
+			name:   "Unknown type",
+			stream: "1a39" + "0000" + "1a32" + "00000000000aff" + "5d4840d6202cc3",
+			want: []result{
+				{Err: ErrUnknownType},
+				{TypeModeSShort, 0x0a, 0xff, "5d4840d6202cc3", nil},
+			},
+		},
+		{
+			name:   "Status frames are skipped",
+			stream: "1a34" + "000000000000000102" + "1a32" + "ff004d4c4154ff" + "5d4840d6202cc3",
+			want:   []result{{TypeModeSShort, MlatTimestamp, 0xff, "5d4840d6202cc3", nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := hex.DecodeString(tt.stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(stream); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next() = \ngot:  %+v\nwant: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader_NextAllocs(t *testing.T) {
+	frame, _ := hex.DecodeString("1a33" + "00001a1a00000001ff" + "8dad73a999117b9b8004285d1c83")
+	stream := bytes.Repeat(frame, 1000)
+	r := NewReader(bytes.NewReader(stream))
+
+	allocs := testing.AllocsPerRun(500, func() {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Next() allocated %.1f times per frame", allocs)
+	}
+}
+
+func TestFrame_AppendBeast(t *testing.T) {
+	stream, _ := hex.DecodeString("1a32" + "00001a1a00001a1a" + "1a1a" + "5d1a1a40d6202cc3")
+	f, err := NewReader(bytes.NewReader(stream)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.AppendBeast(nil); !bytes.Equal(got, stream) {
+		t.Errorf("AppendBeast() = %x, want %x", got, stream)
+	}
+}
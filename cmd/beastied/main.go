@@ -28,6 +28,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -42,6 +43,9 @@ var (
 	beastInfo  = &BeastInfo{}
 	adsbSource = &Source{}
 	mlatSource = &Source{}
+	replay     = &Source{}
+
+	recordMaxSizeMB int64
 )
 
 const LOG_FILE = "/tmp/beastied.log"
@@ -77,6 +81,7 @@ Read more at https://github.io/ccustine/config`,
 					//spew.Dump(metrics.DefaultRegistry)
 					modes.LogOnce(metrics.DefaultRegistry, log.New())
 				}
+				app.CloseRecorders()
 				os.Exit(1)
 			}()
 
@@ -98,15 +103,62 @@ Read more at https://github.io/ccustine/config`,
 	rootCmd.PersistentFlags().IntVar(&adsbSource.Port, BEAST_PORT, 0, "Beast port to connect to")
 	rootCmd.PersistentFlags().StringVar(&mlatSource.Host, MLAT_HOST, "", "MLAT host")
 	rootCmd.PersistentFlags().IntVar(&mlatSource.Port, MLAT_PORT, 0, "MLAT port to connect to")
+	rootCmd.PersistentFlags().StringVar(&adsbSource.Format, BEAST_FMT, FORMAT_BEAST, "ADSB source format (beast, avr or sbs)")
+	rootCmd.PersistentFlags().StringVar(&mlatSource.Format, MLAT_FMT, FORMAT_BEAST, "MLAT source format (beast, avr or sbs)")
+	rootCmd.PersistentFlags().StringVar(&replay.File, REPLAY, "", "Replay a recorded Beast or AVR file instead of connecting to sources")
+	rootCmd.PersistentFlags().StringVar(&replay.Format, REPLAY_FMT, FORMAT_BEAST, "Format of a replayed file without a recording header (beast, avr or sbs)")
+	rootCmd.PersistentFlags().Float64Var(&replay.Speed, REPLAY_SPD, 1, "Replay speed factor, 0 replays as fast as possible. SBS files and AVR captures without timestamps are not paced")
+	rootCmd.PersistentFlags().BoolVar(&replay.Loop, REPLAY_LP, false, "Restart the replay when the end of the file is reached")
+	rootCmd.PersistentFlags().StringVar(&replay.Clock, REPLAY_CLK, CLOCK_12MHZ, "Clock of the replayed timestamps, 12mhz or gps for Radarcape GPS timestamps")
+	rootCmd.PersistentFlags().StringVar(&beastInfo.RecordDir, RECORD, "", "Record the raw Beast stream of every source to this directory")
+	rootCmd.PersistentFlags().Int64Var(&recordMaxSizeMB, REC_SIZE, 100, "Start a new recording after this many MB, 0 to disable")
+	rootCmd.PersistentFlags().DurationVar(&beastInfo.RecordMaxAge, REC_AGE, 0, "Start a new recording after this long, 0 to disable")
+	rootCmd.PersistentFlags().StringVar(&beastInfo.RecordCompress, REC_COMP, "", "Compress recordings with gzip or zstd")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.ListenPort, LISTEN, 0, "Accept Beast streams pushed by remote feeders on this port (e.g. 30104)")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.MaxFeeders, MAX_FEED, 16, "Maximum number of concurrent feeders, 0 for no limit")
+	rootCmd.PersistentFlags().DurationVar(&beastInfo.SourceTimeout, SRC_TMOUT, time.Minute, "Reconnect sources that send nothing for this long, 0 to disable")
+	rootCmd.PersistentFlags().DurationVar(&beastInfo.DedupWindow, DEDUP, 200*time.Millisecond, "Merge copies of a message heard by several receivers within this window, 0 to disable")
 	rootCmd.PersistentFlags().Float64VarP(&beastInfo.Latitude, BASELAT, "", 40.135, "Latitude of ADSB Receiver antenna (not the beastie server)")
 	rootCmd.PersistentFlags().Float64VarP(&beastInfo.Longitude, BASELON, "", -104.997, "Longitude of ADSB Receiver antenna (not the beastie server)")
 	rootCmd.PersistentFlags().StringSliceVarP(&beastInfo.Outputs, OUTPUT, "o", []string{"table"}, "List of outputs, comma delimited")
 	rootCmd.PersistentFlags().BoolVarP(&beastInfo.RtlInput, "rtl", "r", false, "Use RTL SDR as receiver")
+	rootCmd.PersistentFlags().BoolVar(&beastInfo.ModeAC, MODE_AC, false, "Demodulate Mode A/C replies from the RTL SDR, IQ capture or rtl_tcp")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.SampleRate, SMPL_RATE, 2000000, "Sample rate to demodulate the RTL SDR, IQ capture or rtl_tcp at, 2000000 or 2400000 and above")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.CRCFix, CRC_FIX, 1, "Correct up to this many bad bits (0 to 2) in DF11/17/18 messages, others that fail the CRC are dropped")
+	rootCmd.PersistentFlags().Float64Var(&beastInfo.MaxRange, MAX_RANGE, 400, "Reject positions further than this many NM from the receivers, 0 for no limit. Sources and receivers in the config file may set their own location and range")
+	rootCmd.PersistentFlags().StringSliceVar(&beastInfo.HideCategories, HIDE_CAT, nil, "Emitter categories to leave out of the outputs, e.g. C1,C2 for surface vehicles or C for the whole set")
+	rootCmd.PersistentFlags().StringSliceVar(&beastInfo.HighlightCategories, HILITE_CAT, nil, "Emitter categories to highlight in the table, e.g. A7 for rotorcraft")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.MinPositions, MIN_POS, 2, "Consistent positions a new aircraft needs before its position is shown")
+	rootCmd.PersistentFlags().StringVar(&beastInfo.IQFile, IQ_FILE, "", "Demodulate an IQ capture (e.g. from rtl_sdr) instead of an RTL SDR")
+	rootCmd.PersistentFlags().StringVar(&beastInfo.IQFormat, IQ_FMT, "", "IQ capture format (cu8, cs16 or cf32), guessed from the file extension by default")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.IQSampleRate, IQ_RATE, 2000000, "Sample rate of the IQ capture, at least the demodulator sample rate")
+	rootCmd.PersistentFlags().StringVar(&beastInfo.RtlTcp, RTL_TCP, "", "Demodulate samples from a remote RTL SDR served by rtl_tcp (host:port)")
+	rootCmd.PersistentFlags().Float64Var(&beastInfo.RtlTcpGain, RTL_GAIN, 49.6, "Tuner gain of the rtl_tcp dongle in dB, 0 for automatic gain")
+	rootCmd.PersistentFlags().IntVar(&beastInfo.RtlTcpPpm, RTL_PPM, 0, "Frequency correction of the rtl_tcp dongle in ppm")
 
 	viper.BindPFlag("sources.adsb.host", rootCmd.PersistentFlags().Lookup(BEAST_HOST))
 	viper.BindPFlag("sources.adsb.port", rootCmd.PersistentFlags().Lookup(BEAST_PORT))
 	viper.BindPFlag("sources.mlat.host", rootCmd.PersistentFlags().Lookup(MLAT_HOST))
 	viper.BindPFlag("sources.mlat.port", rootCmd.PersistentFlags().Lookup(MLAT_PORT))
+	viper.BindPFlag("sources.adsb.format", rootCmd.PersistentFlags().Lookup(BEAST_FMT))
+	viper.BindPFlag("sources.mlat.format", rootCmd.PersistentFlags().Lookup(MLAT_FMT))
+	viper.BindPFlag(LISTEN, rootCmd.PersistentFlags().Lookup(LISTEN))
+	viper.BindPFlag(MAX_FEED, rootCmd.PersistentFlags().Lookup(MAX_FEED))
+	viper.BindPFlag(SRC_TMOUT, rootCmd.PersistentFlags().Lookup(SRC_TMOUT))
+	viper.BindPFlag(DEDUP, rootCmd.PersistentFlags().Lookup(DEDUP))
+	viper.BindPFlag(MODE_AC, rootCmd.PersistentFlags().Lookup(MODE_AC))
+	viper.BindPFlag(IQ_FILE, rootCmd.PersistentFlags().Lookup(IQ_FILE))
+	viper.BindPFlag(IQ_FMT, rootCmd.PersistentFlags().Lookup(IQ_FMT))
+	viper.BindPFlag(IQ_RATE, rootCmd.PersistentFlags().Lookup(IQ_RATE))
+	viper.BindPFlag(RTL_TCP, rootCmd.PersistentFlags().Lookup(RTL_TCP))
+	viper.BindPFlag(RTL_GAIN, rootCmd.PersistentFlags().Lookup(RTL_GAIN))
+	viper.BindPFlag(RTL_PPM, rootCmd.PersistentFlags().Lookup(RTL_PPM))
+	viper.BindPFlag(SMPL_RATE, rootCmd.PersistentFlags().Lookup(SMPL_RATE))
+	viper.BindPFlag(CRC_FIX, rootCmd.PersistentFlags().Lookup(CRC_FIX))
+	viper.BindPFlag(MAX_RANGE, rootCmd.PersistentFlags().Lookup(MAX_RANGE))
+	viper.BindPFlag(MIN_POS, rootCmd.PersistentFlags().Lookup(MIN_POS))
+	viper.BindPFlag(HIDE_CAT, rootCmd.PersistentFlags().Lookup(HIDE_CAT))
+	viper.BindPFlag(HILITE_CAT, rootCmd.PersistentFlags().Lookup(HILITE_CAT))
 	viper.BindPFlag(BASELAT, rootCmd.PersistentFlags().Lookup(BASELAT))
 	viper.BindPFlag(BASELON, rootCmd.PersistentFlags().Lookup(BASELON))
 
@@ -145,16 +197,29 @@ func begin(cmd *cobra.Command, args []string) {
 		beastInfo.Sources = append(beastInfo.Sources, *adsbSource)
 	} else {
 		beastInfo.Sources = append(beastInfo.Sources, Source{
-			Host: viper.GetString("sources.adsb.host"),
-			Port: viper.GetInt("sources.adsb.port")})
+			Host:      viper.GetString("sources.adsb.host"),
+			Port:      viper.GetInt("sources.adsb.port"),
+			Format:    viper.GetString("sources.adsb.format"),
+			Latitude:  viper.GetFloat64("sources.adsb.lat"),
+			Longitude: viper.GetFloat64("sources.adsb.lon"),
+			MaxRange:  viper.GetFloat64("sources.adsb.maxRange")})
 	}
 
 	if !viper.IsSet("sources.mlat") {
 		beastInfo.Sources = append(beastInfo.Sources, *mlatSource)
 	} else {
 		beastInfo.Sources = append(beastInfo.Sources, Source{
-			Host: viper.GetString("sources.mlat.host"),
-			Port: viper.GetInt("sources.mlat.port")})
+			Host:      viper.GetString("sources.mlat.host"),
+			Port:      viper.GetInt("sources.mlat.port"),
+			Format:    viper.GetString("sources.mlat.format"),
+			Latitude:  viper.GetFloat64("sources.mlat.lat"),
+			Longitude: viper.GetFloat64("sources.mlat.lon"),
+			MaxRange:  viper.GetFloat64("sources.mlat.maxRange")})
+	}
+
+	if replay.File != "" {
+		// The replay is the only source, live frames would be merged with it
+		beastInfo.Sources = []Source{*replay}
 	}
 
 	//viper.UnmarshalKey("sources.adsb", &adsbSource)
@@ -171,6 +236,28 @@ func begin(cmd *cobra.Command, args []string) {
 		beastInfo.Metrics = metricflag
 	*/
 	beastInfo.Metrics = metricflag
+	beastInfo.ListenPort = viper.GetInt(LISTEN)
+	beastInfo.MaxFeeders = viper.GetInt(MAX_FEED)
+	beastInfo.SourceTimeout = viper.GetDuration(SRC_TMOUT)
+	beastInfo.DedupWindow = viper.GetDuration(DEDUP)
+	beastInfo.ModeAC = viper.GetBool(MODE_AC)
+	beastInfo.IQFile = viper.GetString(IQ_FILE)
+	beastInfo.IQFormat = viper.GetString(IQ_FMT)
+	beastInfo.IQSampleRate = viper.GetInt(IQ_RATE)
+	beastInfo.RtlTcp = viper.GetString(RTL_TCP)
+	beastInfo.RtlTcpGain = viper.GetFloat64(RTL_GAIN)
+	beastInfo.RtlTcpPpm = viper.GetInt(RTL_PPM)
+	beastInfo.SampleRate = viper.GetInt(SMPL_RATE)
+	beastInfo.CRCFix = viper.GetInt(CRC_FIX)
+	beastInfo.MaxRange = viper.GetFloat64(MAX_RANGE)
+	beastInfo.MinPositions = viper.GetInt(MIN_POS)
+	// Only the config file places receivers, feeders by their host
+	if err := viper.UnmarshalKey("receivers", &beastInfo.Receivers); err != nil {
+		log.Errorf("Error reading receivers: %s", err)
+	}
+	beastInfo.HideCategories = viper.GetStringSlice(HIDE_CAT)
+	beastInfo.HighlightCategories = viper.GetStringSlice(HILITE_CAT)
+	beastInfo.RecordMaxSize = recordMaxSizeMB * 1024 * 1024
 
 	beastInfo.Homepos = geo.NewPoint(beastInfo.Latitude, beastInfo.Longitude)
 
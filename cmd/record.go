@@ -0,0 +1,83 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ccustine/beastie/app"
+	"github.com/ccustine/beastie/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewRecordCmd() *cobra.Command {
+	info := &config.BeastInfo{}
+	var (
+		maxSizeMB int64
+		format    string
+	)
+
+	recordCmd := &cobra.Command{
+		Use:   "record [host:port ...]",
+		Short: "Record raw Beast streams to disk",
+		Long: `Records the raw Beast frames of one or more sources to rotating files so they
+can be replayed through the decoder later with beastied --replay.
+
+Sources default to the --host and --port flags. AVR sources are recorded as Beast.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{net.JoinHostPort(host, strconv.Itoa(port))}
+			}
+
+			for _, arg := range args {
+				h, p, err := net.SplitHostPort(arg)
+				if err != nil {
+					log.Fatalf("Invalid source %s: %s", arg, err)
+				}
+				portNum, err := strconv.Atoi(p)
+				if err != nil {
+					log.Fatalf("Invalid port in %s: %s", arg, err)
+				}
+				info.Sources = append(info.Sources, config.Source{Host: h, Port: portNum, Format: format})
+			}
+			info.RecordMaxSize = maxSizeMB * 1024 * 1024
+
+			stop := make(chan struct{})
+			sigTerm := make(chan os.Signal, 1)
+			signal.Notify(sigTerm, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sigTerm
+				close(stop)
+			}()
+
+			app.Record(info, stop)
+		},
+	}
+
+	recordCmd.Flags().StringVar(&info.RecordDir, "dir", "recordings", "Directory to write recordings to")
+	recordCmd.Flags().Int64Var(&maxSizeMB, "maxSize", 100, "Start a new file after this many MB, 0 to disable")
+	recordCmd.Flags().DurationVar(&info.RecordMaxAge, "maxAge", 0, "Start a new file after this long, e.g. 1h, 0 to disable")
+	recordCmd.Flags().StringVar(&info.RecordCompress, "compress", "", "Compress recordings with gzip or zstd")
+	recordCmd.Flags().DurationVar(&info.SourceTimeout, config.SRC_TMOUT, time.Minute, "Reconnect sources that send nothing for this long, 0 to disable")
+	recordCmd.Flags().StringVar(&format, "format", config.FORMAT_BEAST, "Source format (beast or avr)")
+
+	return recordCmd
+}
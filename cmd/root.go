@@ -84,6 +84,7 @@ More info at https://github.io/ccustine/config`,
 	rootCmd.AddCommand(registrycmd.NewDownloadCmd(beastInfo))
 	rootCmd.AddCommand(registrycmd.NewListCmd(beastInfo))
 	rootCmd.AddCommand(registrycmd.NewFindCmd(beastInfo))
+	rootCmd.AddCommand(NewRecordCmd())
 	rootCmd.AddCommand(NewVersionCmd())
 
 	log.SetOutput(os.Stdout)
@@ -21,6 +21,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"os"
+	"time"
 )
 
 var (
@@ -36,11 +37,88 @@ type BeastInfo struct {
 	Metrics   bool     `yaml:"metrics"`
 	Outputs   []string `yaml:"output"`
 	RtlInput  bool     `yaml:"rtl"`
+	// Demodulate Mode A/C replies as well as Mode S
+	ModeAC bool `yaml:"modeac"`
+	// Rate to demodulate at, 2000000 or from 2400000 up. RTL SDRs are tuned
+	// to it and IQ captures at higher rates resampled to it.
+	SampleRate int `yaml:"sampleRate"`
+	// Bad bits to correct in DF11/17/18 messages from any source, 0 to
+	// reject every message that fails the CRC, up to 2
+	CRCFix int `yaml:"crcFix"`
+	// Positions further than this many NM from the receiver are rejected, 0
+	// for no limit. Sources and receivers may set their own.
+	MaxRange float64 `yaml:"maxRange"`
+	// Location and range of receivers, such as feeders, that are not at home
+	// or hear further or less far than MaxRange
+	Receivers []Receiver `yaml:"receivers"`
+	// Consistent positions a new aircraft needs before its position is shown
+	MinPositions int `yaml:"minPositions"`
+	// Emitter categories, codes such as A7 or sets such as C, of aircraft to
+	// leave out of the outputs and to highlight in the table
+	HideCategories      []string `yaml:"hideCategories"`
+	HighlightCategories []string `yaml:"highlightCategories"`
+
+	// IQ capture to demodulate instead of an RTL SDR, format is cu8 (default),
+	// cs16 or cf32
+	IQFile       string `yaml:"iqFile"`
+	IQFormat     string `yaml:"iqFormat"`
+	IQSampleRate int    `yaml:"iqRate"`
+
+	// Remote dongle served by rtl_tcp (host:port), gain in dB or 0 for auto
+	RtlTcp     string  `yaml:"rtlTcp"`
+	RtlTcpGain float64 `yaml:"rtlTcpGain"`
+	RtlTcpPpm  int     `yaml:"rtlTcpPpm"`
+
+	// Reconnect sources that deliver no frames for this long, 0 to disable
+	SourceTimeout time.Duration `yaml:"sourceTimeout"`
+	// Merge copies of a message heard by several receivers within this window
+	DedupWindow time.Duration `yaml:"dedupWindow"`
+
+	// Inbound Beast feeders, disabled when ListenPort is 0
+	ListenPort int `yaml:"listenPort"`
+	MaxFeeders int `yaml:"maxFeeders"`
+
+	// Raw stream recording, disabled when RecordDir is empty
+	RecordDir      string        `yaml:"recordDir"`
+	RecordMaxSize  int64         `yaml:"recordMaxSize"`
+	RecordMaxAge   time.Duration `yaml:"recordMaxAge"`
+	RecordCompress string        `yaml:"recordCompress"`
 }
 
 type Source struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host   string `yaml:"host"`
+	Port   int    `yaml:"port"`
+	Format string `yaml:"format"` // beast (default), avr or sbs
+
+	// Replay of a recorded file instead of a network source
+	File  string  `yaml:"file"`
+	Speed float64 `yaml:"speed"` // 1 is real time, 0 is as fast as possible
+	Loop  bool    `yaml:"loop"`
+	Clock string  `yaml:"clock"` // 12mhz (default) or gps timestamps
+
+	// Location of the receiver, home when both are 0, and the range in NM
+	// from it, 0 for the default of every receiver
+	Latitude  float64 `yaml:"lat"`
+	Longitude float64 `yaml:"lon"`
+	MaxRange  float64 `yaml:"maxRange"`
+}
+
+// Receiver places a receiver that is known by name, the host of a feeder or
+// the Name of a source, and limits its range
+type Receiver struct {
+	Name      string  `yaml:"name" mapstructure:"name"`
+	Latitude  float64 `yaml:"lat" mapstructure:"lat"` // Home when both are 0
+	Longitude float64 `yaml:"lon" mapstructure:"lon"`
+	MaxRange  float64 `yaml:"maxRange" mapstructure:"maxRange"` // NM, 0 for the default
+}
+
+// Name is how the receiver of the source is known, the file of a replay and
+// host:port of a network source
+func (s Source) Name() string {
+	if s.File != "" {
+		return s.File
+	}
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
 }
 
 const (
@@ -50,10 +128,51 @@ const (
 	BEAST_PORT = "adsbPort"
 	MLAT_HOST  = "mlatHost"
 	MLAT_PORT  = "mlatPort"
+	BEAST_FMT  = "adsbFormat"
+	MLAT_FMT   = "mlatFormat"
 	BASELAT    = "lat"
 	BASELON    = "lon"
 	CONFIGFILE = "config"
 	OUTPUT     = "out"
+	REPLAY     = "replay"
+	REPLAY_SPD = "replaySpeed"
+	REPLAY_LP  = "replayLoop"
+	REPLAY_FMT = "replayFormat"
+	REPLAY_CLK = "replayClock"
+	RECORD     = "record"
+	REC_SIZE   = "recordMaxSize"
+	REC_AGE    = "recordMaxAge"
+	REC_COMP   = "recordCompress"
+	LISTEN     = "listen"
+	MAX_FEED   = "maxFeeders"
+	SRC_TMOUT  = "sourceTimeout"
+	DEDUP      = "dedupWindow"
+	IQ_FILE    = "iqFile"
+	IQ_FMT     = "iqFormat"
+	IQ_RATE    = "iqRate"
+	RTL_TCP    = "rtlTcp"
+	RTL_GAIN   = "rtlTcpGain"
+	RTL_PPM    = "rtlTcpPpm"
+	MODE_AC    = "modeac"
+	SMPL_RATE  = "sampleRate"
+	CRC_FIX    = "crcFix"
+	MAX_RANGE  = "maxRange"
+	MIN_POS    = "minPositions"
+	HIDE_CAT   = "hideCategories"
+	HILITE_CAT = "highlightCategories"
+)
+
+// Source formats
+const (
+	FORMAT_BEAST = "beast"
+	FORMAT_AVR   = "avr"
+	FORMAT_SBS   = "sbs"
+)
+
+// Replay timestamp clocks
+const (
+	CLOCK_12MHZ = "12mhz"
+	CLOCK_GPS   = "gps"
 )
 
 func LoadConfig() {
@@ -0,0 +1,138 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedup merges copies of the same Mode S message heard by several
+// receivers into one.
+package dedup
+
+import (
+	"time"
+
+	"github.com/ccustine/beastie/beast"
+	"github.com/ccustine/beastie/types"
+)
+
+// Message is a frame together with the receivers that heard it
+type Message struct {
+	beast.Frame
+	Receiver  string            // Receiver of the copy with the best signal
+	Receivers []types.Reception // Every receiver that heard it, the best first
+}
+
+type key struct {
+	payload [beast.MaxPayload]byte
+	n       int
+}
+
+type entry struct {
+	msg     Message
+	key     key
+	expires time.Time
+	done    bool
+}
+
+// Filter holds each message for a window so that copies from other receivers
+// can be merged into it. It is not safe for concurrent use.
+type Filter struct {
+	window  time.Duration
+	pending map[key]*entry
+	queue   []*entry // In order of arrival, so also of expiry
+}
+
+// NewFilter returns a filter for the window, 0 passes every message through
+func NewFilter(window time.Duration) *Filter {
+	return &Filter{
+		window:  window,
+		pending: make(map[key]*entry),
+	}
+}
+
+// Add offers a message received at now and reports whether it was a copy of a
+// pending one. Messages are passed to emit once their window has passed.
+func (f *Filter) Add(m Message, now time.Time, emit func(Message)) bool {
+	// Mode A/C replies carry no address, so copies from different aircraft
+	// cannot be told apart
+	if f.window <= 0 || m.Type == beast.TypeModeAC {
+		m.Receivers = []types.Reception{m.reception()}
+		emit(m)
+		return false
+	}
+
+	f.Flush(now, emit)
+
+	var k key
+	k.n = copy(k.payload[:], m.Payload())
+
+	if e, ok := f.pending[k]; ok {
+		if !contains(e.msg.Receivers, m.Receiver) {
+			receivers := append(e.msg.Receivers, m.reception())
+			// A copy received in the clear is passed on rather than an MLAT
+			// result, which would hide the position it carries
+			if e.msg.IsMlat() && !m.IsMlat() {
+				e.msg.Timestamp = m.Timestamp
+			}
+			// Only the signal and the order of the receivers come from the
+			// stronger copy
+			if m.Signal > e.msg.Signal {
+				e.msg.Signal = m.Signal
+				e.msg.Receiver = m.Receiver
+				last := len(receivers) - 1
+				receivers[0], receivers[last] = receivers[last], receivers[0]
+			}
+			e.msg.Receivers = receivers
+			return true
+		}
+
+		// The same receiver twice is a repeated transmission, not a copy
+		f.emit(e, emit)
+	}
+
+	e := &entry{msg: m, key: k, expires: now.Add(f.window)}
+	e.msg.Receivers = []types.Reception{m.reception()}
+	f.pending[k] = e
+	f.queue = append(f.queue, e)
+	return false
+}
+
+// Flush emits every message whose window has passed by now
+func (f *Filter) Flush(now time.Time, emit func(Message)) {
+	i := 0
+	for ; i < len(f.queue) && !f.queue[i].expires.After(now); i++ {
+		f.emit(f.queue[i], emit)
+		f.queue[i] = nil
+	}
+	f.queue = f.queue[i:]
+}
+
+func (f *Filter) emit(e *entry, emit func(Message)) {
+	if e.done {
+		return
+	}
+	e.done = true
+	delete(f.pending, e.key)
+	emit(e.msg)
+}
+
+func (m *Message) reception() types.Reception {
+	return types.Reception{Receiver: m.Receiver, Rssi: m.Rssi()}
+}
+
+func contains(receivers []types.Reception, receiver string) bool {
+	for _, r := range receivers {
+		if r.Receiver == receiver {
+			return true
+		}
+	}
+	return false
+}
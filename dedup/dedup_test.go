@@ -0,0 +1,172 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ccustine/beastie/beast"
+)
+
+func message(receiver string, signal byte, payload ...byte) Message {
+	m := Message{Receiver: receiver}
+	m.Type = beast.TypeModeSShort
+	m.Timestamp = 1
+	if len(payload) == 2 {
+		m.Type = beast.TypeModeAC
+	}
+	m.Signal = signal
+	m.SetPayload(payload)
+	return m
+}
+
+func TestFilter_Add(t *testing.T) {
+	start := time.Unix(0, 0)
+	window := 100 * time.Millisecond
+
+	tests := []struct {
+		name          string
+		in            []Message
+		wantDups      int
+		wantReceivers [][]string // Receivers of each emitted message, best first
+		wantBest      []string
+	}{
+		{
+			name:          "Copies merged, best signal kept",
+			in:            []Message{message("a", 10, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), message("b", 40, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), message("c", 20, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3)},
+			wantDups:      2,
+			wantReceivers: [][]string{{"b", "a", "c"}},
+			wantBest:      []string{"b"},
+		},
+		{
+			name:          "Different payloads",
+			in:            []Message{message("a", 10, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), message("b", 40, 0x5d, 0xa6, 0xc6, 0xc8, 0x9f, 0x6a, 0xe5)},
+			wantReceivers: [][]string{{"a"}, {"b"}},
+			wantBest:      []string{"a", "b"},
+		},
+		{
+			name:          "Same receiver twice is a new transmission",
+			in:            []Message{message("a", 10, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), message("a", 40, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3)},
+			wantReceivers: [][]string{{"a"}, {"a"}},
+			wantBest:      []string{"a", "a"},
+		},
+		{
+			name:          "Mode A/C passed through",
+			in:            []Message{message("a", 10, 0x12, 0x34), message("b", 40, 0x12, 0x34)},
+			wantReceivers: [][]string{{"a"}, {"b"}},
+			wantBest:      []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewFilter(window)
+			var out []Message
+			emit := func(m Message) {
+				out = append(out, m)
+			}
+
+			dups := 0
+			for i, m := range tt.in {
+				if filter.Add(m, start.Add(time.Duration(i)*time.Millisecond), emit) {
+					dups++
+				}
+			}
+			filter.Flush(start.Add(window+time.Second), emit)
+
+			if dups != tt.wantDups {
+				t.Errorf("Add() reported %d copies, want %d", dups, tt.wantDups)
+			}
+			var receivers [][]string
+			var best []string
+			for _, m := range out {
+				var names []string
+				for _, r := range m.Receivers {
+					names = append(names, r.Receiver)
+				}
+				receivers = append(receivers, names)
+				best = append(best, m.Receiver)
+			}
+			if !reflect.DeepEqual(receivers, tt.wantReceivers) || !reflect.DeepEqual(best, tt.wantBest) {
+				t.Errorf("emitted receivers %v best %v, want %v best %v", receivers, best, tt.wantReceivers, tt.wantBest)
+			}
+		})
+	}
+}
+
+func TestFilter_Add_Mlat(t *testing.T) {
+	start := time.Unix(0, 0)
+	payload := []byte{0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3}
+
+	tests := []struct {
+		name string
+		in   []Message
+	}{
+		{"stronger MLAT copy", []Message{message("a", 10, payload...), mlat(message("mlat", 40, payload...))}},
+		{"weaker copy in the clear", []Message{mlat(message("mlat", 40, payload...)), message("a", 10, payload...)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewFilter(100 * time.Millisecond)
+			var out []Message
+			emit := func(m Message) {
+				out = append(out, m)
+			}
+			for _, m := range tt.in {
+				filter.Add(m, start, emit)
+			}
+			filter.Flush(start.Add(time.Second), emit)
+
+			if len(out) != 1 {
+				t.Fatalf("got %d messages, want 1", len(out))
+			}
+			if got := out[0]; got.IsMlat() || got.Timestamp != 1 || got.Signal != 40 || got.Receiver != "mlat" {
+				t.Errorf("emitted mlat %t timestamp %d signal %d from %q, want the frame of a with the signal of mlat",
+					got.IsMlat(), got.Timestamp, got.Signal, got.Receiver)
+			}
+		})
+	}
+}
+
+func mlat(m Message) Message {
+	m.Timestamp = beast.MlatTimestamp
+	return m
+}
+
+func TestFilter_Window(t *testing.T) {
+	start := time.Unix(0, 0)
+	filter := NewFilter(100 * time.Millisecond)
+	var out []Message
+	emit := func(m Message) {
+		out = append(out, m)
+	}
+
+	filter.Add(message("a", 10, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), start, emit)
+	filter.Flush(start.Add(50*time.Millisecond), emit)
+	if len(out) != 0 {
+		t.Fatalf("message emitted before its window passed")
+	}
+
+	// Late copies start a new message
+	filter.Add(message("b", 10, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3), start.Add(150*time.Millisecond), emit)
+	if len(out) != 1 {
+		t.Fatalf("got %d messages after the window, want 1", len(out))
+	}
+	filter.Flush(start.Add(time.Second), emit)
+	if len(out) != 2 || out[1].Receiver != "b" {
+		t.Errorf("late copy was not emitted separately: %+v", out)
+	}
+}
@@ -0,0 +1,251 @@
+package input
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IQ sample formats
+const (
+	FormatCU8  = "cu8"  // rtl_sdr: unsigned 8 bit I, Q
+	FormatCS16 = "cs16" // signed 16 bit little endian I, Q
+	FormatCF32 = "cf32" // 32 bit float little endian I, Q (GNU Radio)
+
+	// The rate the demodulator expects by default
+	DemodSampleRate = 2000000
+)
+
+// IQFileScanner reads a capture of 1090 MHz IQ samples from disk so the
+// demodulator can run without a dongle. Captures at higher rates than
+// DemodRate are resampled. The sample channel is closed at the end of the
+// capture.
+type IQFileScanner struct {
+	Path       string
+	Format     string
+	SampleRate int
+	DemodRate  int  // Rate the samples are delivered at
+	Realtime   bool // Deliver samples at the rate they were captured
+
+	file    *os.File
+	dataLen int
+	dataCh  chan *SourceIQ
+	done    chan struct{}
+	closed  sync.Once
+	err     error // Set before dataCh is closed
+}
+
+func NewIQFileScanner(path string, format string, sampleRate int, demodRate int, dataLen int) (*IQFileScanner, error) {
+	if format == "" {
+		format = formatFromExt(path)
+	}
+	switch format {
+	case FormatCU8, FormatCS16, FormatCF32:
+	default:
+		return nil, fmt.Errorf("unknown IQ format %q", format)
+	}
+	if !SampleRateSupported(demodRate) {
+		return nil, fmt.Errorf("can not demodulate at %d samples per second", demodRate)
+	}
+	if sampleRate < demodRate {
+		return nil, fmt.Errorf("sample rate %d is below %d", sampleRate, demodRate)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IQFileScanner{
+		Path:       path,
+		Format:     format,
+		SampleRate: sampleRate,
+		DemodRate:  demodRate,
+		file:       file,
+		dataLen:    dataLen,
+		dataCh:     make(chan *SourceIQ, 1),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+func formatFromExt(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cs16":
+		return FormatCS16
+	case ".cf32", ".cfile", ".fc32":
+		return FormatCF32
+	}
+	return FormatCU8
+}
+
+func (s *IQFileScanner) Start() error {
+	go func() {
+		s.err = s.read()
+		close(s.dataCh)
+	}()
+	return nil
+}
+
+func (s *IQFileScanner) read() error {
+	r := bufio.NewReaderSize(s.file, 1<<16)
+	res := &iqResampler{step: float64(s.SampleRate) / float64(s.DemodRate)}
+	chunkTime := time.Duration(s.dataLen/2) * time.Second / time.Duration(s.DemodRate)
+	start := time.Now()
+
+	var (
+		in   []complex64
+		out  = make([]uint8, 0, s.dataLen)
+		sent int
+	)
+	for {
+		var err error
+		in, err = readSamples(r, s.Format, in[:0], 8192)
+		if len(in) > 0 {
+			if s.SampleRate == s.DemodRate {
+				out = appendCU8(out, in)
+			} else {
+				out = res.resample(in, out)
+			}
+		}
+
+		for len(out) >= s.dataLen || (err != nil && len(out) > 0) {
+			n := len(out)
+			if n > s.dataLen {
+				n = s.dataLen
+			}
+			chunk := make([]uint8, n)
+			copy(chunk, out[:n])
+			out = append(out[:0], out[n:]...)
+
+			if s.Realtime {
+				time.Sleep(time.Until(start.Add(time.Duration(sent) * chunkTime)))
+			}
+			select {
+			case s.dataCh <- NewSourceIQ(chunk, n):
+				sent++
+			case <-s.done:
+				return nil
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *IQFileScanner) Close() {
+	s.closed.Do(func() {
+		close(s.done)
+		s.file.Close()
+	})
+}
+
+func (s *IQFileScanner) GetSourceIQCh() <-chan *SourceIQ {
+	return s.dataCh
+}
+
+// Error returns why the capture ended, io.EOF once all of it has been
+// delivered. It may only be called once the sample channel is closed.
+func (s *IQFileScanner) Error() error {
+	return s.err
+}
+
+// readSamples appends up to n samples normalized to [-1, 1]
+func readSamples(r *bufio.Reader, format string, dst []complex64, n int) ([]complex64, error) {
+	var size int
+	switch format {
+	case FormatCS16:
+		size = 4
+	case FormatCF32:
+		size = 8
+	default:
+		size = 2
+	}
+
+	buf := make([]byte, size)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return dst, err
+		}
+
+		var iv, qv float32
+		switch format {
+		case FormatCS16:
+			iv = float32(int16(binary.LittleEndian.Uint16(buf))) / 32768
+			qv = float32(int16(binary.LittleEndian.Uint16(buf[2:]))) / 32768
+		case FormatCF32:
+			iv = math.Float32frombits(binary.LittleEndian.Uint32(buf))
+			qv = math.Float32frombits(binary.LittleEndian.Uint32(buf[4:]))
+		default:
+			iv = (float32(buf[0]) - 127.5) / 127.5
+			qv = (float32(buf[1]) - 127.5) / 127.5
+		}
+		dst = append(dst, complex(iv, qv))
+	}
+	return dst, nil
+}
+
+func appendCU8(dst []uint8, samples []complex64) []uint8 {
+	for _, s := range samples {
+		dst = append(dst, toU8(real(s)), toU8(imag(s)))
+	}
+	return dst
+}
+
+func toU8(v float32) uint8 {
+	u := math.Round(float64(v)*127.5 + 127.5)
+	if u < 0 {
+		return 0
+	} else if u > 255 {
+		return 255
+	}
+	return uint8(u)
+}
+
+// iqResampler decimates a sample stream to the demodulator rate by averaging the
+// input over each output sample period, carrying partial periods across reads
+type iqResampler struct {
+	step float64 // Input samples per output sample
+	edge float64 // End of the current output period, relative to the read
+	acc  complex64
+	accW float64
+}
+
+func (r *iqResampler) resample(in []complex64, dst []uint8) []uint8 {
+	if r.edge == 0 {
+		r.edge = r.step
+	}
+
+	for i, sample := range in {
+		lo := float64(i)
+		for r.edge <= float64(i+1) {
+			w := r.edge - lo
+			r.acc += sample * complex(float32(w), 0)
+			r.accW += w
+
+			s := r.acc / complex(float32(r.accW), 0)
+			dst = append(dst, toU8(real(s)), toU8(imag(s)))
+
+			lo = r.edge
+			r.edge += r.step
+			r.acc, r.accW = 0, 0
+		}
+		w := float64(i+1) - lo
+		r.acc += sample * complex(float32(w), 0)
+		r.accW += w
+	}
+
+	r.edge -= float64(len(in))
+	return dst
+}
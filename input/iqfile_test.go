@@ -0,0 +1,158 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// modulate returns the IQ samples of message sent after 100us of silence
+func modulate(message []byte, sampleRate int, format string) []byte {
+	return modulateAt(message, 0, sampleRate, format)
+}
+
+// modulateAt is modulate with the message sent delay us later
+func modulateAt(message []byte, delay float64, sampleRate int, format string) []byte {
+	return sampleSignal(func(us float64) bool {
+		us -= delay
+		slot := func(start float64) bool { return us >= start && us < start+0.5 }
+		if slot(0) || slot(1) || slot(3.5) || slot(4.5) {
+			return true
+		}
+		bit := int(us - 8)
+		if us < 8 || bit >= len(message)*8 {
+			return false
+		}
+		one := message[bit/8]&(0x80>>uint(bit%8)) != 0
+		if one {
+			return slot(8 + float64(bit))
+		}
+		return slot(8.5 + float64(bit))
+	}, sampleRate, format)
+}
+
+// sampleSignal returns 300us of IQ samples of a pulse signal, where high
+// reports whether a pulse is on at a time relative to 100us in. Each sample is
+// the average of the signal over its period, as a receiver's filter would see it.
+func sampleSignal(high func(us float64) bool, sampleRate int, format string) []byte {
+	var buf bytes.Buffer
+	total := int(float64(sampleRate) * 300e-6)
+	for n := 0; n < total; n++ {
+		const steps = 60
+		var on int
+		for i := 0; i < steps; i++ {
+			if high((float64(n)+float64(i)/steps)*1e6/float64(sampleRate) - 100) {
+				on++
+			}
+		}
+		amp := 0.6 * float64(on) / steps
+		iv, qv := amp*math.Cos(0.3), amp*math.Sin(0.3)
+		switch format {
+		case FormatCS16:
+			binary.Write(&buf, binary.LittleEndian, []int16{int16(iv * 32767), int16(qv * 32767)})
+		case FormatCF32:
+			binary.Write(&buf, binary.LittleEndian, []float32{float32(iv), float32(qv)})
+		default:
+			buf.Write([]byte{toU8(float32(iv)), toU8(float32(qv))})
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestIQFileScanner(t *testing.T) {
+	message, _ := hex.DecodeString("8d4840d6202cc371c32ce0576098")
+
+	tests := []struct {
+		name       string
+		format     string
+		sampleRate int
+	}{
+		{"cu8", FormatCU8, 2000000},
+		{"cs16", FormatCS16, 2000000},
+		{"cf32", FormatCF32, 2000000},
+		{"cu8 at 2.4 Msps", FormatCU8, 2400000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "capture")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			file.Write(modulate(message, tt.sampleRate, tt.format))
+			file.Close()
+
+			scanner, err := NewIQFileScanner(file.Name(), tt.format, tt.sampleRate, DemodSampleRate, DataLen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer scanner.Close()
+			scanner.Start()
+
+			demod := NewDemod(0)
+			go func() {
+				for iq := range scanner.GetSourceIQCh() {
+					demod.Process(iq)
+				}
+			}()
+
+			select {
+			case msg := <-demod.MessageCh:
+				if !bytes.Equal(msg.Msg, message) {
+					t.Errorf("DetectModeS() = %x, want %x", msg.Msg, message)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message demodulated")
+			}
+		})
+	}
+}
+
+func TestIQFileScanner_End(t *testing.T) {
+	file, err := ioutil.TempFile("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(make([]byte, DataLen*3+100))
+	file.Close()
+
+	scanner, err := NewIQFileScanner(file.Name(), FormatCU8, DemodSampleRate, DemodSampleRate, DataLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner.Start()
+
+	chunks := 0
+	for range scanner.GetSourceIQCh() {
+		chunks++
+	}
+	if chunks != 4 || scanner.Error() != io.EOF {
+		t.Errorf("scanner delivered %d chunks and ended with %v, want 4 and EOF", chunks, scanner.Error())
+	}
+
+	// Closing twice is harmless
+	scanner.Close()
+	scanner.Close()
+}
+
+func TestNewIQFileScanner_Errors(t *testing.T) {
+	if _, err := NewIQFileScanner("capture.cu8", "cs8", DemodSampleRate, DemodSampleRate, DataLen); err == nil {
+		t.Error("NewIQFileScanner() accepted an unknown format")
+	}
+	if _, err := NewIQFileScanner("capture.cu8", FormatCU8, 1000000, DemodSampleRate, DataLen); err == nil {
+		t.Error("NewIQFileScanner() accepted a rate below the demodulator's")
+	}
+	if _, err := NewIQFileScanner("capture.cu8", FormatCU8, DemodSampleRate*2, 2200000, DataLen); err == nil {
+		t.Error("NewIQFileScanner() accepted a rate the demodulator does not support")
+	}
+	if _, err := NewIQFileScanner("does-not-exist.cu8", FormatCU8, DemodSampleRate, DemodSampleRate, DataLen); err == nil {
+		t.Error("NewIQFileScanner() opened a missing file")
+	}
+}
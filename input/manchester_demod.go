@@ -6,6 +6,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"math"
 	"os"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 )
@@ -41,7 +43,7 @@ var (
 		0x000000, 0x000000, 0x000000, 0x000000, 0x000000, 0x000000, 0x000000, 0x000000,
 	}
 
-	RtlBadRate = metrics.GetOrRegisterMeter("Message Rate (RTL Bad)", metrics.DefaultRegistry)
+	RtlBadRate  = metrics.GetOrRegisterMeter("Message Rate (RTL Bad)", metrics.DefaultRegistry)
 	RtlGoodRate = metrics.GetOrRegisterMeter("Message Rate (RTL Good)", metrics.DefaultRegistry)
 )
 
@@ -54,22 +56,66 @@ type (
 		Data        []uint8
 		DataLen     int
 		ReceiptTime time.Time
-		mag         []uint16
 	}
 
+	// Demod demodulates chunks on a pool of workers and emits their messages
+	// in the order the chunks were received
 	Demod struct {
 		MessageCh chan Message
-		icaoCache map[uint]time.Time
-		wg *sync.WaitGroup
+		// Also detect Mode A/C replies. Off by default as noise produces
+		// false replies far more often than false Mode S messages.
+		ModeAC bool
+		// SampleRate of the chunks, DemodSampleRate unless set before the
+		// first Process. Rates of MinPhaseSampleRate and above are
+		// demodulated by phase, and Mode A/C replies are only detected at
+		// DemodSampleRate.
+		SampleRate int
+
+		icaoCache *icaoCache
+		work      chan *demodJob
+		order     chan *demodJob
+		tail      []uint8
+		noise     float64 // Running noise floor, only used by sequence
+		wg        *sync.WaitGroup
+	}
+
+	demodJob struct {
+		chunk    *SourceIQ
+		noise    float64 // Set before messages is sent
+		messages chan []Message
+	}
+
+	// icaoCache holds the addresses recently seen in messages with a CRC so
+	// the address can be recovered from the parity of other downlink formats
+	icaoCache struct {
+		sync.Mutex
+		seen map[uint]time.Time
 	}
 )
 
-func NewDemod() *Demod {
-	return &Demod{
-		MessageCh: make(chan Message, 1),
-		icaoCache: make(map[uint]time.Time),
-		wg: &sync.WaitGroup{},
+// NewDemod starts a demodulator with the given number of workers, or one per
+// CPU when workers is 0
+func NewDemod(workers int) *Demod {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
 	}
+
+	d := &Demod{
+		MessageCh:  make(chan Message, 1),
+		SampleRate: DemodSampleRate,
+		icaoCache:  &icaoCache{seen: make(map[uint]time.Time)},
+		work:       make(chan *demodJob, workers),
+		order:      make(chan *demodJob, workers*2),
+		wg:         &sync.WaitGroup{},
+	}
+
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+	d.wg.Add(1)
+	go d.sequence()
+
+	return d
 }
 
 func NewSourceIQ(data []uint8, dataLen int) *SourceIQ {
@@ -80,64 +126,145 @@ func NewSourceIQ(data []uint8, dataLen int) *SourceIQ {
 	}
 }
 
+// Process queues a chunk for demodulation, blocking while every worker is
+// busy. Chunks must be passed from a single goroutine in the order they were
+// received so that messages spanning two chunks are found.
+func (d *Demod) Process(chunk *SourceIQ) {
+	data := make([]uint8, 0, len(d.tail)+chunk.DataLen)
+	data = append(append(data, d.tail...), chunk.Data[:chunk.DataLen&^1]...)
+
+	// Messages starting in the last FullLen us are not complete until the
+	// next chunk, so those samples are scanned again with it
+	tailLen := msgSamples(d.SampleRate) * 2
+	if tailLen > len(data) {
+		tailLen = len(data)
+	}
+	d.tail = append(d.tail[:0], data[len(data)-tailLen:]...)
+
+	job := &demodJob{
+		chunk: &SourceIQ{
+			Data:        data,
+			DataLen:     len(data),
+			ReceiptTime: chunk.ReceiptTime,
+		},
+		messages: make(chan []Message, 1),
+	}
+	d.order <- job
+	d.work <- job
+}
+
+// Close waits for the queued chunks to be demodulated and closes MessageCh,
+// which must be drained until then.
 func (d *Demod) Close() {
+	close(d.order)
+	close(d.work)
 	d.wg.Wait()
 }
 
-func (d *Demod) DetectModeS(chunk *SourceIQ) {
-	d.wg.Add(1)
-	d.computeMagnitudeVector(chunk)
+func (d *Demod) worker() {
+	for job := range d.work {
+		mag := computeMagnitudeVector(job.chunk)
+		messages := d.detect(job.chunk, mag)
+		job.noise = noisePower(mag)
+		job.messages <- messages
+	}
+}
+
+// sequence emits the messages of each chunk once all earlier chunks are done
+func (d *Demod) sequence() {
+	defer d.wg.Done()
+
+	for job := range d.order {
+		messages := <-job.messages
+		d.updateNoise(job.noise)
+		for _, msg := range messages {
+			msg.Noise = d.noise
+			markSignal(&msg)
+			d.MessageCh <- msg
+		}
+	}
+	close(d.MessageCh)
+}
+
+// detect returns the messages in a chunk in the order they were received
+func (d *Demod) detect(chunk *SourceIQ, mag []uint16) []Message {
+	messages := d.modeS(chunk, mag)
+	if !d.ModeAC || d.SampleRate != DemodSampleRate {
+		return messages
+	}
+
+	messages = append(messages, detectModeAC(chunk, mag, messages)...)
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].offset < messages[j].offset
+	})
+	return messages
+}
+
+// DetectModeS returns the Mode S messages in a single chunk. It does not
+// modify the chunk and is safe to call concurrently.
+func (d *Demod) DetectModeS(chunk *SourceIQ) []Message {
+	return d.modeS(chunk, computeMagnitudeVector(chunk))
+}
+
+func (d *Demod) modeS(chunk *SourceIQ, mag []uint16) []Message {
+	if d.SampleRate != DemodSampleRate {
+		return d.detectModeSPhase(chunk, mag)
+	}
+	return d.detectModeS(chunk, mag)
+}
+
+func (d *Demod) detectModeS(chunk *SourceIQ, mag []uint16) []Message {
 	var (
 		bits          = make([]uint8, LongMsgBits)
 		msg           = make([]uint8, LongMsgBits/2)
 		aux           = make([]uint16, LongMsgBits*2)
+		messages      []Message
 		useCorrection bool
 	)
 
 	// main each
-	for j := 0; j < len(chunk.mag)-(FullLen*2); j++ {
+	for j := 0; j < len(mag)-(FullLen*2); j++ {
 		var high, delta, low, errors int
 		goodMessage := false
 
 		if useCorrection {
-			for i := j + PreambleUs*2; i < len(aux); i++ {
-				aux[i] = chunk.mag[i]
-			}
+			// Phase correction is only applied for this attempt
+			copy(aux, mag[j+PreambleUs*2:])
 
-			if j > 0 && detectOutOfPhase(chunk.mag, j) > 0 {
-				applyPhaseCorrection(chunk.mag, j)
+			if j > 0 && detectOutOfPhase(mag, j) > 0 {
+				applyPhaseCorrection(mag, j)
 			}
 		} else {
-			if !(chunk.mag[j] > chunk.mag[j+1] &&
-				chunk.mag[j+1] < chunk.mag[j+2] &&
-				chunk.mag[j+2] > chunk.mag[j+3] &&
-				chunk.mag[j+3] < chunk.mag[j] &&
-				chunk.mag[j+4] < chunk.mag[j] &&
-				chunk.mag[j+5] < chunk.mag[j] &&
-				chunk.mag[j+6] < chunk.mag[j] &&
-				chunk.mag[j+7] > chunk.mag[j+8] &&
-				chunk.mag[j+8] < chunk.mag[j+9] &&
-				chunk.mag[j+9] > chunk.mag[j+6]) {
+			if !(mag[j] > mag[j+1] &&
+				mag[j+1] < mag[j+2] &&
+				mag[j+2] > mag[j+3] &&
+				mag[j+3] < mag[j] &&
+				mag[j+4] < mag[j] &&
+				mag[j+5] < mag[j] &&
+				mag[j+6] < mag[j] &&
+				mag[j+7] > mag[j+8] &&
+				mag[j+8] < mag[j+9] &&
+				mag[j+9] > mag[j+6]) {
 				continue
 			}
 
-			high = int((chunk.mag[j] + chunk.mag[j+2] + chunk.mag[j+7] + chunk.mag[j+9]) / 6)
-			if int(chunk.mag[j+4]) >= high ||
-				int(chunk.mag[j+5]) >= high {
+			high = int((mag[j] + mag[j+2] + mag[j+7] + mag[j+9]) / 6)
+			if int(mag[j+4]) >= high ||
+				int(mag[j+5]) >= high {
 				continue
 			}
 
-			if int(chunk.mag[j+11]) >= high ||
-				int(chunk.mag[j+12]) >= high ||
-				int(chunk.mag[j+13]) >= high ||
-				int(chunk.mag[j+14]) >= high {
+			if int(mag[j+11]) >= high ||
+				int(mag[j+12]) >= high ||
+				int(mag[j+13]) >= high ||
+				int(mag[j+14]) >= high {
 				continue
 			}
 		}
 
 		for i := 0; i < LongMsgBits*2; i += 2 {
-			low = int(chunk.mag[j+i+PreambleUs*2])
-			high = int(chunk.mag[j+i+PreambleUs*2+1])
+			low = int(mag[j+i+PreambleUs*2])
+			high = int(mag[j+i+PreambleUs*2+1])
 			delta = int(low - high)
 			if delta < 0 {
 				delta = -delta
@@ -159,9 +286,7 @@ func (d *Demod) DetectModeS(chunk *SourceIQ) {
 		}
 
 		if useCorrection {
-			for i := 0; i < len(aux); i++ {
-				chunk.mag[j+PreambleUs*2] = aux[i]
-			}
+			copy(mag[j+PreambleUs*2:], aux)
 		}
 
 		for i := 0; i < LongMsgBits; i += 8 {
@@ -184,8 +309,8 @@ func (d *Demod) DetectModeS(chunk *SourceIQ) {
 		delta = 0
 		for i := 0; i < msgLen*8*2; i += 2 {
 			delta += int(
-				math.Abs(float64(int16(chunk.mag[j+i+PreambleUs*2]) -
-					int16(chunk.mag[j+i+PreambleUs*2+1]))),
+				math.Abs(float64(int16(mag[j+i+PreambleUs*2]) -
+					int16(mag[j+i+PreambleUs*2+1]))),
 			)
 		}
 		delta /= int(msgLen * 4)
@@ -196,61 +321,20 @@ func (d *Demod) DetectModeS(chunk *SourceIQ) {
 		}
 
 		if errors == 0 {
-			mmsg := make([]uint8, msgLen)
-			for i := 0; i < msgLen; i++ {
-				mmsg[i] = msg[i]
-			}
-
-			crc := CRC(mmsg, msgLen)
-			sum := modesChecksum(mmsg, msgLen*8)
-
-			var crcOK = crc == sum
-
-			var errorBit int
-
-			if !crcOK && isADSB(msgType) {
-				if errorBit = fixSingleBitErrors(mmsg, msgLen*8); errorBit != -1 {
-					crcOK = true
-					crc = modesChecksum(mmsg, int(msgLen*8))
-				}
-
-				if errorBit == -1 {
-					if errorBit = fixTwoBitsErrors(mmsg, msgLen*8); errorBit != -1 {
-						crcOK = true
-						crc = modesChecksum(mmsg, int(msgLen*8))
-					}
-				}
-			}
-
-			var icao []uint8
-
-			if crcOK && isADSB(msgType) {
-				icao = []uint8{mmsg[1], mmsg[2], mmsg[3]}
-			}
-
-			// DF
-			if !crcOK && isDownlinkRequest(msgType) {
-				if ok, _icao := d.bruteForceAp(msg, int(msgLen*8)); ok {
-					crcOK = true
-					icao = _icao
-				}
-			}
-
-			if crcOK {
+			if mmsg, icao, ok := d.checkMessage(msg, msgLen); ok {
+				offset := j
 				j += (PreambleUs + (msgLen * 8)) * 2
 				goodMessage = true
 
-				if isADSB(msgType) {
-					icaoMask := (uint(mmsg[1]) << 16) | (uint(mmsg[2]) << 8) | uint(mmsg[3])
-					d.addICAOForCache(icaoMask)
-				}
-
-				d.MessageCh <- Message{
+				messages = append(messages, Message{
 					ReceiptTime: chunk.ReceiptTime,
 					Msg:         mmsg,
 					DF:          msgType,
 					ICAO:        icao,
-				}
+					Type:        TypeModeS,
+					Signal:      pulsePower(mag, float64(offset+PreambleUs*2), 1, msgLen*8),
+					offset:      offset,
+				})
 				if logrus.IsLevelEnabled(logrus.DebugLevel) {
 					fmt.Fprintf(os.Stderr, "Good Message: %x\n", mmsg)
 				}
@@ -264,7 +348,6 @@ func (d *Demod) DetectModeS(chunk *SourceIQ) {
 			}
 		}
 
-
 		if !goodMessage && !useCorrection {
 			j--
 			useCorrection = true
@@ -273,21 +356,60 @@ func (d *Demod) DetectModeS(chunk *SourceIQ) {
 		}
 	}
 
-	d.wg.Done()
+	return messages
 }
 
-func (d *Demod) addICAOForCache(icao uint) {
-	d.icaoCache[icao] = time.Now()
+// checkMessage copies the first msgLen bytes of a demodulated message and
+// checks its CRC, correcting bit errors in extended squitters and recovering
+// the address of replies that carry it in the parity
+func (d *Demod) checkMessage(msg []uint8, msgLen int) (mmsg []uint8, icao []uint8, crcOK bool) {
+	msgType := msg[0] >> 3
+	mmsg = make([]uint8, msgLen)
+	copy(mmsg, msg)
+
+	crc := CRC(mmsg, msgLen)
+	sum := modesChecksum(mmsg, msgLen*8)
+	crcOK = crc == sum
+
+	if !crcOK && isADSB(msgType) {
+		if fixSingleBitErrors(mmsg, msgLen*8) != -1 || fixTwoBitsErrors(mmsg, msgLen*8) != -1 {
+			crcOK = true
+		}
+	}
+
+	if crcOK && isADSB(msgType) {
+		icao = []uint8{mmsg[1], mmsg[2], mmsg[3]}
+		d.icaoCache.add(uint(mmsg[1])<<16 | uint(mmsg[2])<<8 | uint(mmsg[3]))
+	}
+
+	// DF
+	if !crcOK && isDownlinkRequest(msgType) {
+		if ok, _icao := d.bruteForceAp(msg, msgLen*8); ok {
+			crcOK = true
+			icao = _icao
+		}
+	}
+
+	return mmsg, icao, crcOK
+}
+
+func (c *icaoCache) add(icao uint) {
+	c.Lock()
+	c.seen[icao] = time.Now()
+	c.Unlock()
 }
 
-func (d *Demod) hasICAOFromCache(icao uint) bool {
-	t, ok := d.icaoCache[icao]
+func (c *icaoCache) has(icao uint) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	t, ok := c.seen[icao]
 	if !ok {
 		return false
 	}
 
 	if time.Since(t).Seconds() > 60 {
-		delete(d.icaoCache, icao)
+		delete(c.seen, icao)
 
 		return false
 	}
@@ -295,14 +417,10 @@ func (d *Demod) hasICAOFromCache(icao uint) bool {
 	return true
 }
 
-func (d *Demod) DetectModeAC() {
-	//TODO
-}
-
-func (d *Demod) computeMagnitudeVector(chunk *SourceIQ) {
-	chunk.mag = make([]uint16, chunk.DataLen/2)
+func computeMagnitudeVector(chunk *SourceIQ) []uint16 {
+	mag := make([]uint16, chunk.DataLen/2)
 
-	for j := 0; j < chunk.DataLen; j += 2 {
+	for j := 0; j+1 < chunk.DataLen; j += 2 {
 		var i = int(chunk.Data[j]) - 127
 		var q = int(chunk.Data[j+1]) - 127
 
@@ -314,13 +432,15 @@ func (d *Demod) computeMagnitudeVector(chunk *SourceIQ) {
 			q = -q
 		}
 
-		chunk.mag[j/2] = magLutTable[uint16((i*129)+q)]
+		mag[j/2] = magLutTable[uint16((i*129)+q)]
 	}
+
+	return mag
 }
 
 func isADSB(t uint8) bool {
 	switch t {
-	case 11, 17,18:
+	case 11, 17, 18:
 		return true
 	}
 
@@ -354,7 +474,7 @@ func (d *Demod) bruteForceAp(msg []uint8, bits int) (bool, []uint8) {
 	aux[lastbyte-2] ^= uint8((crc >> 16) & 0xff)
 
 	addr := uint(aux[lastbyte]) | (uint(aux[lastbyte-1]) << 8) | (uint(aux[lastbyte-2]) << 16)
-	if d.hasICAOFromCache(addr) {
+	if d.icaoCache.has(addr) {
 		return true, []uint8{aux[lastbyte-2], aux[lastbyte-1], aux[lastbyte]}
 	}
 
@@ -424,9 +544,9 @@ func fixTwoBitsErrors(msg []uint8, bits int) int {
 	return -1
 }
 
+// msgLenBits returns the length of a downlink format, which is long from DF16
 func msgLenBits(t uint8) int {
-	switch t {
-	case 0, 4, 5, 16, 17, 20, 21, 24:
+	if t >= 16 {
 		return LongMsgBits
 	}
 
@@ -0,0 +1,151 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// identMessage returns a DF17 identification message for icao with a valid CRC
+func identMessage(icao uint32) []byte {
+	msg := []byte{0x8d, byte(icao >> 16), byte(icao >> 8), byte(icao), 0x20, 0x2c, 0xc3, 0x71, 0xc3, 0x2c, 0xe0, 0, 0, 0}
+	crc := modesChecksum(msg, LongMsgBits)
+	msg[11], msg[12], msg[13] = byte(crc>>16), byte(crc>>8), byte(crc)
+	return msg
+}
+
+// iqStream returns count messages at 2 Msps cu8, with low level noise between
+// them when noisy is set
+func iqStream(count int, noisy bool) ([]byte, [][]byte) {
+	rnd := rand.New(rand.NewSource(1))
+	var stream bytes.Buffer
+	var messages [][]byte
+	for i := 0; i < count; i++ {
+		msg := identMessage(0x400000 + uint32(i))
+		messages = append(messages, msg)
+		samples := modulate(msg, DemodSampleRate, FormatCU8)
+		if noisy {
+			for j := range samples {
+				samples[j] += byte(rnd.Intn(7)) - 3
+			}
+		}
+		stream.Write(samples)
+	}
+	return stream.Bytes(), messages
+}
+
+func TestDemod_Process(t *testing.T) {
+	stream, want := iqStream(64, false)
+
+	tests := []struct {
+		name     string
+		workers  int
+		chunkLen int
+	}{
+		// Every other message is split between two chunks
+		{"split messages", 4, 1000},
+		{"chunks shorter than a message", 4, 200},
+		{"single worker", 1, DataLen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			demod := NewDemod(tt.workers)
+			go func() {
+				for i := 0; i < len(stream); i += tt.chunkLen {
+					end := i + tt.chunkLen
+					if end > len(stream) {
+						end = len(stream)
+					}
+					demod.Process(NewSourceIQ(stream[i:end], end-i))
+				}
+				demod.Close()
+			}()
+
+			var got [][]byte
+			for msg := range demod.MessageCh {
+				got = append(got, msg.Msg)
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("Process() found %d messages, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !bytes.Equal(got[i], want[i]) {
+					t.Errorf("message %d = %x, want %x", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDemod_DetectModeS_DoesNotModifyChunk(t *testing.T) {
+	stream, _ := iqStream(4, true)
+	chunk := NewSourceIQ(append([]byte(nil), stream...), len(stream))
+
+	demod := NewDemod(1)
+	defer demod.Close()
+	if msgs := demod.DetectModeS(chunk); len(msgs) != 4 {
+		t.Errorf("DetectModeS() found %d messages, want 4", len(msgs))
+	}
+	if !bytes.Equal(chunk.Data, stream) {
+		t.Error("DetectModeS() modified the chunk")
+	}
+}
+
+// 2 Msps of cu8 samples is 4 MB/s, so the reported throughput must stay above
+// that with room to spare for a live dongle
+func BenchmarkDemod(b *testing.B) {
+	stream, _ := iqStream(2000, true)
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(stream)))
+			for n := 0; n < b.N; n++ {
+				demod := NewDemod(workers)
+				go func() {
+					for i := 0; i < len(stream); i += DataLen {
+						end := i + DataLen
+						if end > len(stream) {
+							end = len(stream)
+						}
+						demod.Process(NewSourceIQ(stream[i:end], end-i))
+					}
+					demod.Close()
+				}()
+				for range demod.MessageCh {
+				}
+			}
+		})
+	}
+}
+
+func TestDemod_DetectModeS_AddressParity(t *testing.T) {
+	const icao = 0x4840d6
+	// DF4 at 35000 ft with the address overlaid on the parity
+	reply := []byte{0x20, 0, 0x16, 0x90, 0, 0, 0}
+	crc := modesChecksum(reply, ShortMsgBits) ^ icao
+	reply[4], reply[5], reply[6] = byte(crc>>16), byte(crc>>8), byte(crc)
+
+	var stream []byte
+	stream = append(stream, modulate(identMessage(icao), DemodSampleRate, FormatCU8)...)
+	stream = append(stream, modulate(reply, DemodSampleRate, FormatCU8)...)
+
+	demod := NewDemod(1)
+	defer demod.Close()
+	msgs := demod.DetectModeS(NewSourceIQ(stream, len(stream)))
+	if len(msgs) != 2 {
+		t.Fatalf("DetectModeS() found %d messages, want 2", len(msgs))
+	}
+	if !bytes.Equal(msgs[1].Msg, reply) || !bytes.Equal(msgs[1].ICAO, []byte{0x48, 0x40, 0xd6}) {
+		t.Errorf("DetectModeS() = %x from %x, want %x from 4840d6", msgs[1].Msg, msgs[1].ICAO, reply)
+	}
+
+	// Without the extended squitter the address is not trusted
+	demod = NewDemod(1)
+	defer demod.Close()
+	single := modulate(reply, DemodSampleRate, FormatCU8)
+	if msgs := demod.DetectModeS(NewSourceIQ(single, len(single))); len(msgs) != 0 {
+		t.Errorf("DetectModeS() accepted a reply from an unknown address: %x", msgs[0].Msg)
+	}
+}
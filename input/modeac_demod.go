@@ -0,0 +1,118 @@
+package input
+
+// A Mode A/C reply is a pair of framing pulses 20.3us apart with up to 13
+// code pulses 1.45us apart between them, and an optional SPI pulse 4.35us
+// after the second framing pulse. Every pulse is 0.45us long, so at 2 Msps a
+// pulse always falls within two consecutive samples.
+const (
+	modeACBitUs   = 1.45
+	modeACF2Bit   = 14
+	modeACSpiUs   = 24.65
+	modeACLen     = 50 // samples from F1 to the end of the SPI pulse
+	modeACMinEdge = 10 * 255
+)
+
+// The code bit of each pulse after F1, laid out like a squawk. The X pulse
+// in the middle is never sent.
+var modeACBits = [...]uint16{
+	0x0010, 0x1000, 0x0020, 0x2000, 0x0040, 0x4000, 0, // C1 A1 C2 A2 C4 A4 X
+	0x0100, 0x0001, 0x0200, 0x0002, 0x0400, 0x0004, // B1 D1 B2 D2 B4 D4
+}
+
+const modeACSpiBit = 0x0080
+
+// DetectModeAC returns the Mode A/C replies in a single chunk, skipping the
+// Mode S messages already found in it by DetectModeS. It does not modify the
+// chunk and is safe to call concurrently.
+func (d *Demod) DetectModeAC(chunk *SourceIQ, modeS []Message) []Message {
+	return detectModeAC(chunk, computeMagnitudeVector(chunk), modeS)
+}
+
+func detectModeAC(chunk *SourceIQ, mag []uint16, modeS []Message) []Message {
+	var messages []Message
+
+	// pulse returns the energy of a pulse starting t us after the start of
+	// sample j plus phase samples
+	pulse := func(j int, phase float64, t float64) int {
+		s := j + int(phase+t*2)
+		return int(mag[s]) + int(mag[s+1])
+	}
+
+	next := 0
+	for j := 1; j < len(mag)-(FullLen*2); j++ {
+		// Mode A/C replies can not overlap a Mode S message
+		for next < len(modeS) && j >= modeS[next].offset {
+			msgEnd := modeS[next].offset + (PreambleUs+len(modeS[next].Msg)*8)*2
+			if j < msgEnd {
+				j = msgEnd
+			}
+			next++
+		}
+		if j >= len(mag)-(FullLen*2) {
+			break
+		}
+
+		// F1 starts in the sample where the energy of two samples peaks
+		f1 := int(mag[j]) + int(mag[j+1])
+		if f1 < modeACMinEdge ||
+			f1 < int(mag[j-1])+int(mag[j]) ||
+			f1 <= int(mag[j+1])+int(mag[j+2]) {
+			continue
+		}
+
+		// Estimate where in sample j the pulse starts from how it is split
+		// between the two samples
+		phase := 0.1 + 0.9*float64(mag[j+1])/float64(f1)
+
+		f2 := pulse(j, phase, modeACF2Bit*modeACBitUs)
+		ref := f1
+		if f2 < ref {
+			ref = f2
+		}
+		if f1 > 2*f2 || f2 > 2*f1 {
+			continue
+		}
+
+		// Nothing is sent just before F1 or between F2 and SPI
+		noise := int(mag[j-1])
+		for i := j + 43; i <= j+48; i++ {
+			if int(mag[i]) > noise {
+				noise = int(mag[i])
+			}
+		}
+		if ref < 4*noise {
+			continue
+		}
+
+		var code uint16
+		valid := true
+		for k, bit := range modeACBits {
+			if pulse(j, phase, float64(k+1)*modeACBitUs) > ref/2 {
+				if bit == 0 {
+					valid = false
+					break
+				}
+				code |= bit
+			}
+		}
+		if !valid {
+			continue
+		}
+		if pulse(j, phase, modeACSpiUs) > ref/2 {
+			code |= modeACSpiBit
+		}
+
+		// Each framing pulse is 0.9 samples long, split between two
+		level := float64(f1+f2) / 2 / 0.9 / magFullScale
+		messages = append(messages, Message{
+			ReceiptTime: chunk.ReceiptTime,
+			Msg:         []uint8{uint8(code >> 8), uint8(code)},
+			Type:        TypeModeAC,
+			Signal:      level * level,
+			offset:      j,
+		})
+		j += modeACLen
+	}
+
+	return messages
+}
@@ -0,0 +1,90 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// modulateModeAC returns the IQ samples of a Mode A/C reply with code, laid
+// out like a squawk, starting at 100us plus delay
+func modulateModeAC(code uint16, delay float64) []byte {
+	return sampleSignal(func(us float64) bool {
+		us -= delay
+		pulse := func(start float64) bool { return us >= start && us < start+0.45 }
+		if pulse(0) || pulse(modeACF2Bit*modeACBitUs) {
+			return true
+		}
+		if code&modeACSpiBit != 0 && pulse(modeACSpiUs) {
+			return true
+		}
+		for k, bit := range modeACBits {
+			if code&bit != 0 && pulse(float64(k+1)*modeACBitUs) {
+				return true
+			}
+		}
+		return false
+	}, DemodSampleRate, FormatCU8)
+}
+
+func TestDemod_DetectModeAC(t *testing.T) {
+	codes := []uint16{0x7700, 0x1200, 0x0000, 0x7777, 0x3401 | modeACSpiBit, 0x0456}
+
+	demod := NewDemod(1)
+	defer demod.Close()
+	for _, code := range codes {
+		for _, delay := range []float64{0, 0.1, 0.25, 0.4} {
+			t.Run(fmt.Sprintf("%04x+%.2fus", code, delay), func(t *testing.T) {
+				samples := modulateModeAC(code, delay)
+				msgs := demod.DetectModeAC(NewSourceIQ(samples, len(samples)), nil)
+				if len(msgs) != 1 {
+					t.Fatalf("DetectModeAC() found %d replies, want 1", len(msgs))
+				}
+				want := []byte{uint8(code >> 8), uint8(code)}
+				if msgs[0].Type != TypeModeAC || !bytes.Equal(msgs[0].Msg, want) {
+					t.Errorf("DetectModeAC() = %x, want %x", msgs[0].Msg, want)
+				}
+			})
+		}
+	}
+}
+
+func TestDemod_DetectModeAC_SkipsModeS(t *testing.T) {
+	stream, _ := iqStream(16, true)
+	chunk := NewSourceIQ(stream, len(stream))
+
+	demod := NewDemod(1)
+	defer demod.Close()
+	modeS := demod.DetectModeS(chunk)
+	if len(modeS) != 16 {
+		t.Fatalf("DetectModeS() found %d messages, want 16", len(modeS))
+	}
+	if msgs := demod.DetectModeAC(chunk, modeS); len(msgs) != 0 {
+		t.Errorf("DetectModeAC() found %d replies in Mode S traffic", len(msgs))
+	}
+}
+
+func TestDemod_Process_ModeAC(t *testing.T) {
+	modeS := modulate(identMessage(0x4840d6), DemodSampleRate, FormatCU8)
+	var stream []byte
+	stream = append(stream, modeS...)
+	stream = append(stream, modulateModeAC(0x7700, 0.1)...)
+	stream = append(stream, modeS...)
+
+	demod := NewDemod(2)
+	demod.ModeAC = true
+	go func() {
+		demod.Process(NewSourceIQ(stream, len(stream)))
+		// Flush the last message out of the overlap
+		demod.Process(NewSourceIQ(make([]byte, FullLen*8), FullLen*8))
+		demod.Close()
+	}()
+
+	var got []uint8
+	for msg := range demod.MessageCh {
+		got = append(got, msg.Type)
+	}
+	if want := []uint8{TypeModeS, TypeModeAC, TypeModeS}; !bytes.Equal(got, want) {
+		t.Errorf("Process() message types = %v, want %v", got, want)
+	}
+}
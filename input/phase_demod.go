@@ -0,0 +1,207 @@
+package input
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Above 2 Msps a half bit no longer lines up with whole samples, so rather
+// than comparing single samples like detectModeS the phase demodulator
+// integrates the magnitude over each half bit, weighting the samples at either
+// end by how much of them falls inside it. A preamble is tried at several start
+// phases over the next half bit and the bits sliced at each in turn, best
+// first, until one passes the CRC, which is how readsb demodulates at 2.4 Msps.
+const (
+	// MinPhaseSampleRate is the lowest rate the phase demodulator handles,
+	// 1.2 samples per half bit
+	MinPhaseSampleRate = 2400000
+
+	// Quiet half bits of the preamble must stay below a sixth of the sum of
+	// its four pulses, the same threshold detectModeS uses
+	phaseHighDiv = 6
+)
+
+// preambleQuiet are the half bits of the preamble where nothing is sent, the
+// pulses being in half bits 0, 2, 7 and 9
+var preambleQuiet = [...]int{1, 3, 4, 5, 6, 8, 10, 11, 12, 13, 14, 15}
+
+type phaseCandidate struct {
+	start float64 // in samples
+	score float64
+}
+
+// SampleRateSupported reports whether the demodulator can run at sampleRate
+func SampleRateSupported(sampleRate int) bool {
+	return sampleRate == DemodSampleRate || sampleRate >= MinPhaseSampleRate
+}
+
+// msgSamples is the number of samples in the longest message at sampleRate,
+// with room for the start phases and the last partial sample
+func msgSamples(sampleRate int) int {
+	if sampleRate == DemodSampleRate {
+		return FullLen * 2
+	}
+	return int(math.Ceil(float64(FullLen)*float64(sampleRate)/1e6+float64(sampleRate)/2e6)) + 2
+}
+
+// phaseSteps is the number of start phases tried within a sample, enough to
+// place each half bit to within a fifth of its length
+func phaseSteps(halfBit float64) int {
+	steps := int(math.Ceil(5 / halfBit))
+	if steps < 1 {
+		steps = 1
+	}
+	return steps
+}
+
+// integrate returns the sum of mag between the fractional sample positions a
+// and b
+func integrate(mag []uint16, a, b float64) float64 {
+	i, end := int(a), int(b)
+	if i == end {
+		return float64(mag[i]) * (b - a)
+	}
+
+	sum := float64(mag[i]) * (float64(i+1) - a)
+	for i++; i < end; i++ {
+		sum += float64(mag[i])
+	}
+	if frac := b - float64(end); frac > 0 {
+		sum += float64(mag[end]) * frac
+	}
+	return sum
+}
+
+func (d *Demod) detectModeSPhase(chunk *SourceIQ, mag []uint16) []Message {
+	var (
+		halfBit  = float64(d.SampleRate) / 1e6 / 2
+		steps    = phaseSteps(halfBit)
+		tries    = steps * int(math.Ceil(halfBit))
+		msg      = make([]uint8, LongMsgBits/8)
+		slots    [PreambleUs * 2]float64
+		phases   []phaseCandidate
+		messages []Message
+	)
+
+	// halfBits fills slots with the energy of each half bit of the preamble
+	// starting at t, up to n of them
+	halfBits := func(t float64, n int) {
+		for k := 0; k < n; k++ {
+			slots[k] = integrate(mag, t+float64(k)*halfBit, t+float64(k+1)*halfBit)
+		}
+	}
+
+	for j := 0; j < len(mag)-msgSamples(d.SampleRate); j++ {
+		// The edges of the preamble pulses show before it is aligned, so a
+		// preamble starting within the next half bit passes this check
+		halfBits(float64(j)+0.5, 10)
+		if !(slots[0] > slots[1] && slots[2] > slots[1] && slots[2] > slots[3] &&
+			slots[7] > slots[6] && slots[7] > slots[8] && slots[9] > slots[8]) {
+			continue
+		}
+
+		// The score peaks where the preamble lines up with the half bits
+		phases = phases[:0]
+		for p := 0; p < tries; p++ {
+			start := float64(j) + float64(p)/float64(steps)
+			halfBits(start, len(slots))
+			if score, ok := preambleScore(&slots); ok {
+				phases = append(phases, phaseCandidate{start, score})
+			}
+		}
+		if len(phases) == 0 {
+			continue
+		}
+		sort.Slice(phases, func(a, b int) bool { return phases[a].score > phases[b].score })
+
+		var mmsg []uint8
+		found := false
+		for _, phase := range phases {
+			msgLen, ok := sliceBits(mag, phase.start+PreambleUs*2*halfBit, halfBit, msg)
+			if !ok {
+				continue
+			}
+
+			var icao []uint8
+			if mmsg, icao, found = d.checkMessage(msg, msgLen); !found {
+				continue
+			}
+
+			messages = append(messages, Message{
+				ReceiptTime: chunk.ReceiptTime,
+				Msg:         mmsg,
+				DF:          mmsg[0] >> 3,
+				ICAO:        icao,
+				Type:        TypeModeS,
+				Signal:      pulsePower(mag, phase.start+PreambleUs*2*halfBit, halfBit, msgLen*8),
+				offset:      int(phase.start),
+			})
+			if logrus.IsLevelEnabled(logrus.DebugLevel) {
+				fmt.Fprintf(os.Stderr, "Good Message: %x\n", mmsg)
+			}
+			RtlGoodRate.Mark(1)
+
+			j = int(phase.start+float64(PreambleUs+msgLen*8)*2*halfBit) - 1
+			break
+		}
+
+		if !found && mmsg != nil {
+			if logrus.IsLevelEnabled(logrus.DebugLevel) {
+				fmt.Fprintf(os.Stderr, "Bad Message: %x\n", mmsg)
+			}
+			RtlBadRate.Mark(1)
+		}
+	}
+
+	return messages
+}
+
+// preambleScore checks the shape of a preamble from the energy of its half
+// bits and scores how far its pulses stand above the quiet half bits
+func preambleScore(slots *[PreambleUs * 2]float64) (float64, bool) {
+	pulses := slots[0] + slots[2] + slots[7] + slots[9]
+	high := pulses / phaseHighDiv
+
+	quiet := 0.0
+	for _, k := range preambleQuiet {
+		if slots[k] >= high {
+			return 0, false
+		}
+		quiet += slots[k]
+	}
+
+	return pulses/4 - quiet/float64(len(preambleQuiet)), true
+}
+
+// sliceBits demodulates a message starting at the fractional sample start
+// into msg, returning its length in bytes. It fails when the bits are too
+// weak to be told apart from noise.
+func sliceBits(mag []uint16, start, halfBit float64, msg []uint8) (int, bool) {
+	msgLen := LongMsgBits / 8
+	delta := 0.0
+
+	for i := 0; i < msgLen*8; i++ {
+		t := start + float64(i)*2*halfBit
+		first := integrate(mag, t, t+halfBit)
+		second := integrate(mag, t+halfBit, t+2*halfBit)
+
+		if first > second {
+			msg[i/8] |= 0x80 >> uint(i%8)
+		} else {
+			msg[i/8] &^= 0x80 >> uint(i%8)
+		}
+		delta += math.Abs(first - second)
+
+		if i == 7 {
+			msgLen = msgLenBits(msg[0]>>3) / 8
+		}
+	}
+
+	// Same threshold on the difference between the halves of a bit as
+	// detectModeS, scaled to the samples in a half bit
+	return msgLen, 2*delta/float64(msgLen*8)/halfBit >= 10*255
+}
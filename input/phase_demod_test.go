@@ -0,0 +1,206 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestIntegrate(t *testing.T) {
+	mag := []uint16{10, 20, 30, 40}
+
+	tests := []struct {
+		a, b float64
+		want float64
+	}{
+		{0, 1, 10},
+		{0, 2, 30},
+		{0.5, 1, 5},
+		{0.5, 2.5, 5 + 20 + 15},
+		{1.2, 2.4, 0.8*20 + 0.4*30},
+		{1, 3, 50},
+	}
+	for _, tt := range tests {
+		if got := integrate(mag, tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("integrate(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDemod_DetectModeS_Phase(t *testing.T) {
+	message := identMessage(0x4840d6)
+
+	for _, rate := range []int{2400000, 3200000, 8000000} {
+		demod := NewDemod(1)
+		demod.SampleRate = rate
+		for _, delay := range []float64{0, 0.1, 0.23, 0.37, 0.5} {
+			t.Run(fmt.Sprintf("%d+%.2fus", rate, delay), func(t *testing.T) {
+				samples := modulateAt(message, delay, rate, FormatCU8)
+				msgs := demod.DetectModeS(NewSourceIQ(samples, len(samples)))
+				if len(msgs) != 1 {
+					t.Fatalf("DetectModeS() found %d messages, want 1", len(msgs))
+				}
+				if !bytes.Equal(msgs[0].Msg, message) {
+					t.Errorf("DetectModeS() = %x, want %x", msgs[0].Msg, message)
+				}
+			})
+		}
+		demod.Close()
+	}
+}
+
+func TestDemod_Process_Phase(t *testing.T) {
+	const rate = 2400000
+	var stream []byte
+	var want [][]byte
+	for i := 0; i < 32; i++ {
+		msg := identMessage(0x400000 + uint32(i))
+		want = append(want, msg)
+		stream = append(stream, modulateAt(msg, float64(i%7)*0.07, rate, FormatCU8)...)
+	}
+
+	demod := NewDemod(4)
+	demod.SampleRate = rate
+	go func() {
+		for i := 0; i < len(stream); i += 1000 {
+			end := i + 1000
+			if end > len(stream) {
+				end = len(stream)
+			}
+			demod.Process(NewSourceIQ(stream[i:end], end-i))
+		}
+		demod.Close()
+	}()
+
+	var got [][]byte
+	for msg := range demod.MessageCh {
+		got = append(got, msg.Msg)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Process() found %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("message %d = %x, want %x", i, got[i], want[i])
+		}
+	}
+}
+
+// noisyCapture returns a cu8 capture of count messages delayed by up to jitter
+// us, with gaussian noise snr dB below the signal
+func noisyCapture(count int, sampleRate int, snr float64, jitter float64) []byte {
+	rnd := rand.New(rand.NewSource(int64(sampleRate)))
+
+	var capture []byte
+	for i := 0; i < count; i++ {
+		capture = append(capture, modulateAt(identMessage(0x400000+uint32(i)), rnd.Float64()*jitter, sampleRate, FormatCU8)...)
+	}
+	addNoise(capture, snr, rnd)
+	return capture
+}
+
+// addNoise adds gaussian noise snr dB below the level of modulated messages
+// to cu8 samples
+func addNoise(samples []byte, snr float64, rnd *rand.Rand) {
+	sigma := 0.6 * 127.5 / math.Pow(10, snr/20) / math.Sqrt2
+	for j := range samples {
+		v := math.Round(float64(samples[j]) + rnd.NormFloat64()*sigma)
+		samples[j] = uint8(math.Max(0, math.Min(255, v)))
+	}
+}
+
+// demodCapture demodulates a capture file the way beastied does and returns
+// the number of distinct messages found
+func demodCapture(t *testing.T, path string, sampleRate, demodRate int) int {
+	scanner, err := NewIQFileScanner(path, FormatCU8, sampleRate, demodRate, DataLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	scanner.Start()
+
+	demod := NewDemod(0)
+	demod.SampleRate = demodRate
+	go func() {
+		for iq := range scanner.GetSourceIQCh() {
+			demod.Process(iq)
+		}
+		demod.Close()
+	}()
+
+	found := make(map[string]bool)
+	for msg := range demod.MessageCh {
+		found[string(msg.Msg)] = true
+	}
+	return len(found)
+}
+
+// TestDemodYield reports the share of messages decoded from captures at each
+// sample rate as the noise rises; run with -v to see it
+func TestDemodYield(t *testing.T) {
+	const count = 100
+	snrs := []float64{30, 20, 14}
+
+	tests := []struct {
+		name       string
+		sampleRate int
+		demodRate  int
+		minYield   []float64 // at each SNR
+	}{
+		{"2 Msps", 2000000, 2000000, []float64{0.7, 0.2, 0}},
+		{"2.4 Msps resampled to 2 Msps", 2400000, 2000000, []float64{0.4, 0.05, 0}},
+		{"2.4 Msps", 2400000, 2400000, []float64{0.95, 0.85, 0.5}},
+		{"8 Msps", 8000000, 8000000, []float64{0.95, 0.95, 0.95}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, snr := range snrs {
+				file, err := ioutil.TempFile("", "capture")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.Remove(file.Name())
+				file.Write(noisyCapture(count, tt.sampleRate, snr, 1))
+				file.Close()
+
+				yield := float64(demodCapture(t, file.Name(), tt.sampleRate, tt.demodRate)) / count
+				t.Logf("%s at %.0f dB SNR: %.0f%% decoded", tt.name, snr, yield*100)
+				if yield < tt.minYield[i] {
+					t.Errorf("%s at %.0f dB SNR decoded %.0f%%, want at least %.0f%%",
+						tt.name, snr, yield*100, tt.minYield[i]*100)
+				}
+			}
+		})
+	}
+}
+
+// A dongle at 2.4 Msps delivers 4.8 MB/s of cu8 samples and an 8 Msps SDR
+// 16 MB/s
+func BenchmarkDemod_Phase(b *testing.B) {
+	for _, rate := range []int{2400000, 8000000} {
+		stream := noisyCapture(500, rate, 20, 1)
+		b.Run(fmt.Sprintf("rate=%d", rate), func(b *testing.B) {
+			b.SetBytes(int64(len(stream)))
+			for n := 0; n < b.N; n++ {
+				demod := NewDemod(1)
+				demod.SampleRate = rate
+				go func() {
+					for i := 0; i < len(stream); i += DataLen {
+						end := i + DataLen
+						if end > len(stream) {
+							end = len(stream)
+						}
+						demod.Process(NewSourceIQ(stream[i:end], end-i))
+					}
+					demod.Close()
+				}()
+				for range demod.MessageCh {
+				}
+			}
+		})
+	}
+}
@@ -27,11 +27,15 @@ type Message struct {
 	DF          uint8
 	Type        uint8
 	ReceiptTime time.Time
+	Signal      float64 // Mean power of the pulses relative to full scale
+	Noise       float64 // Noise floor power when the message was received
+
+	offset int // Sample of the chunk the message starts at
 }
 
 
 
-func NewRtlSdrScanner(dataLen int) *RtlSdrScanner {
+func NewRtlSdrScanner(sampleRate int, dataLen int) *RtlSdrScanner {
 	scanner := &RtlSdrScanner{
 		// dataBuff: make([]uint8, dataLen),
 		dataLen: dataLen,
@@ -58,7 +62,7 @@ func NewRtlSdrScanner(dataLen int) *RtlSdrScanner {
 	scanner.device.SetAgcMode(false)
 	scanner.device.SetFreqCorrection(0)
 	scanner.device.SetCenterFreq(1090000000)
-	scanner.device.SetSampleRate(2000000)
+	scanner.device.SetSampleRate(sampleRate)
 	scanner.device.SetTunerGainMode(false)
 	scanner.device.ResetBuffer()
 
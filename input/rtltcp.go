@@ -0,0 +1,175 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// rtl_tcp commands, each sent as a command byte followed by a big endian
+// uint32 parameter
+const (
+	rtlTcpSetFreq           = 0x01
+	rtlTcpSetSampleRate     = 0x02
+	rtlTcpSetGainMode       = 0x03
+	rtlTcpSetGain           = 0x04
+	rtlTcpSetFreqCorrection = 0x05
+	rtlTcpSetAgcMode        = 0x08
+)
+
+var (
+	rtlTcpMagic = []byte("RTL0")
+
+	rtlTunerTypes = []string{"unknown", "E4000", "FC0012", "FC0013", "FC2580", "R820T", "R828D"}
+)
+
+// DongleInfo is the header rtl_tcp sends when a client connects
+type DongleInfo struct {
+	TunerType      uint32
+	TunerGainCount uint32
+}
+
+func (i DongleInfo) TunerName() string {
+	if int(i.TunerType) < len(rtlTunerTypes) {
+		return rtlTunerTypes[i.TunerType]
+	}
+	return rtlTunerTypes[0]
+}
+
+// RtlTcpScanner receives IQ samples from a dongle shared over the network by
+// rtl_tcp, so the demodulation can run away from the receiver. The sample
+// channel is closed when the stream ends.
+type RtlTcpScanner struct {
+	Addr   string
+	Dongle DongleInfo
+
+	conn    net.Conn
+	dataLen int
+	dataCh  chan *SourceIQ
+	done    chan struct{}
+	closed  sync.Once
+	err     error // Set before dataCh is closed
+}
+
+// NewRtlTcpScanner connects to rtl_tcp at addr and tunes the dongle for Mode S.
+// Gain is in dB, 0 selects automatic gain.
+func NewRtlTcpScanner(addr string, sampleRate int, gain float64, freqCorrection int, dataLen int) (*RtlTcpScanner, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := &RtlTcpScanner{
+		Addr:    addr,
+		conn:    conn,
+		dataLen: dataLen,
+		dataCh:  make(chan *SourceIQ, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err = scanner.readDongleInfo(); err == nil {
+		err = scanner.tune(sampleRate, gain, freqCorrection)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return scanner, nil
+}
+
+func (s *RtlTcpScanner) readDongleInfo() error {
+	header := make([]byte, 12)
+	s.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return fmt.Errorf("reading rtl_tcp header: %s", err)
+	}
+	s.conn.SetReadDeadline(time.Time{})
+
+	if !bytes.Equal(header[:4], rtlTcpMagic) {
+		return fmt.Errorf("%s is not an rtl_tcp server", s.Addr)
+	}
+	s.Dongle.TunerType = binary.BigEndian.Uint32(header[4:])
+	s.Dongle.TunerGainCount = binary.BigEndian.Uint32(header[8:])
+	return nil
+}
+
+func (s *RtlTcpScanner) tune(sampleRate int, gain float64, freqCorrection int) error {
+	commands := [][2]uint32{
+		{rtlTcpSetSampleRate, uint32(sampleRate)},
+		{rtlTcpSetFreq, 1090000000},
+		{rtlTcpSetFreqCorrection, uint32(int32(freqCorrection))},
+		{rtlTcpSetAgcMode, 0},
+	}
+	if gain == 0 {
+		commands = append(commands, [2]uint32{rtlTcpSetGainMode, 0})
+	} else {
+		commands = append(commands,
+			[2]uint32{rtlTcpSetGainMode, 1},
+			[2]uint32{rtlTcpSetGain, uint32(gain * 10)})
+	}
+
+	for _, c := range commands {
+		if err := s.command(byte(c[0]), c[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RtlTcpScanner) command(cmd byte, param uint32) error {
+	buf := make([]byte, 5)
+	buf[0] = cmd
+	binary.BigEndian.PutUint32(buf[1:], param)
+	_, err := s.conn.Write(buf)
+	return err
+}
+
+func (s *RtlTcpScanner) Start() error {
+	go func() {
+		s.err = s.read()
+		close(s.dataCh)
+	}()
+	return nil
+}
+
+func (s *RtlTcpScanner) read() error {
+	for {
+		data := make([]byte, s.dataLen)
+		n, err := io.ReadFull(s.conn, data)
+		if n > 0 {
+			select {
+			case s.dataCh <- NewSourceIQ(data[:n], n):
+			case <-s.done:
+				return nil
+			}
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *RtlTcpScanner) Close() {
+	s.closed.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *RtlTcpScanner) GetSourceIQCh() <-chan *SourceIQ {
+	return s.dataCh
+}
+
+// Error returns the reason the stream from rtl_tcp ended, nil when it was
+// closed. It may only be called once the sample channel is closed.
+func (s *RtlTcpScanner) Error() error {
+	return s.err
+}
@@ -0,0 +1,161 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeRtlTcp accepts a single client, records the commands it sends and
+// streams samples to it, like rtl_tcp replaying a capture. The connection
+// stays open until the client closes it.
+func fakeRtlTcp(t *testing.T, samples []byte) (string, <-chan [2]uint32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands := make(chan [2]uint32, 16)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		header := append([]byte("RTL0"), 0, 0, 0, 5, 0, 0, 0, 29)
+		conn.Write(header)
+
+		go conn.Write(samples)
+
+		buf := make([]byte, 5)
+		for {
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			commands <- [2]uint32{uint32(buf[0]), binary.BigEndian.Uint32(buf[1:])}
+		}
+	}()
+
+	return ln.Addr().String(), commands
+}
+
+func TestRtlTcpScanner(t *testing.T) {
+	message, _ := hex.DecodeString("8d4840d6202cc371c32ce0576098")
+	// Pad to a whole read with silence
+	samples := bytes.Repeat([]byte{128}, DataLen)
+	copy(samples, modulate(message, DemodSampleRate, FormatCU8))
+	addr, commands := fakeRtlTcp(t, samples)
+
+	scanner, err := NewRtlTcpScanner(addr, DemodSampleRate, 42.1, -3, DataLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+
+	if scanner.Dongle.TunerName() != "R820T" || scanner.Dongle.TunerGainCount != 29 {
+		t.Errorf("NewRtlTcpScanner() dongle = %s with %d gains, want R820T with 29",
+			scanner.Dongle.TunerName(), scanner.Dongle.TunerGainCount)
+	}
+
+	want := map[uint32]uint32{
+		rtlTcpSetSampleRate:     2000000,
+		rtlTcpSetFreq:           1090000000,
+		rtlTcpSetFreqCorrection: 0xfffffffd,
+		rtlTcpSetAgcMode:        0,
+		rtlTcpSetGainMode:       1,
+		rtlTcpSetGain:           421,
+	}
+	for range want {
+		select {
+		case c := <-commands:
+			if param, ok := want[c[0]]; !ok || param != c[1] {
+				t.Errorf("command 0x%02x = %d, want %d", c[0], c[1], param)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing rtl_tcp commands")
+		}
+	}
+
+	scanner.Start()
+	demod := NewDemod(0)
+	go func() {
+		for iq := range scanner.GetSourceIQCh() {
+			demod.Process(iq)
+		}
+	}()
+
+	select {
+	case msg := <-demod.MessageCh:
+		if !bytes.Equal(msg.Msg, message) {
+			t.Errorf("DetectModeS() = %x, want %x", msg.Msg, message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message demodulated")
+	}
+}
+
+func TestRtlTcpScanner_HangUp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write(append([]byte("RTL0"), 0, 0, 0, 5, 0, 0, 0, 29))
+		// The five commands of automatic gain, then a read and a half
+		io.ReadFull(conn, make([]byte, 5*5))
+		conn.Write(make([]byte, DataLen*3/2))
+		conn.Close()
+	}()
+
+	scanner, err := NewRtlTcpScanner(ln.Addr().String(), DemodSampleRate, 0, 0, DataLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner.Start()
+
+	chunks := 0
+	for range scanner.GetSourceIQCh() {
+		chunks++
+	}
+	if chunks != 2 {
+		t.Errorf("scanner delivered %d chunks before the hang up, want 2", chunks)
+	}
+	if err := scanner.Error(); err != io.EOF {
+		t.Errorf("Error() = %v, want %v", err, io.EOF)
+	}
+
+	// Closing twice is harmless
+	scanner.Close()
+	scanner.Close()
+}
+
+func TestNewRtlTcpScanner_NotRtlTcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 400"))
+		conn.Close()
+	}()
+
+	if _, err := NewRtlTcpScanner(ln.Addr().String(), DemodSampleRate, 0, 0, DataLen); err == nil {
+		t.Error("NewRtlTcpScanner() accepted a server that is not rtl_tcp")
+	}
+}
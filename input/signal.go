@@ -0,0 +1,101 @@
+package input
+
+import (
+	"math"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// Magnitude of a full scale sample, where I or Q reaches the limit
+	magFullScale = 128 * 360
+
+	// Weight of each chunk in the running noise floor, which follows a change
+	// in about a second of chunks
+	noiseFloorAlpha = 0.05
+
+	// Messages above StrongSignal dBFS are close to overloading the receiver,
+	// those below WeakSNR dB above the noise floor close to being lost
+	StrongSignal = -3.0
+	WeakSNR      = 10.0
+)
+
+var (
+	RtlNoiseFloor = metrics.GetOrRegisterGaugeFloat64("Noise Floor (RTL)", metrics.DefaultRegistry)
+	RtlStrongRate = metrics.GetOrRegisterMeter("Message Rate (RTL Strong)", metrics.DefaultRegistry)
+	RtlWeakRate   = metrics.GetOrRegisterMeter("Message Rate (RTL Weak)", metrics.DefaultRegistry)
+)
+
+// Rssi returns the signal level of the message in dBFS
+func (m *Message) Rssi() float64 {
+	return 10 * math.Log10(m.Signal)
+}
+
+// SNR returns how far the message was above the noise floor in dB
+func (m *Message) SNR() float64 {
+	return 10 * math.Log10(m.Signal/m.Noise)
+}
+
+// SignalByte returns the signal level the way Beast frames carry it, the
+// square root of the power scaled to 255
+func (m *Message) SignalByte() byte {
+	level := math.Round(math.Sqrt(m.Signal) * 255)
+	if level > 255 {
+		return 255
+	}
+	return byte(level)
+}
+
+func markSignal(m *Message) {
+	if m.Rssi() > StrongSignal {
+		RtlStrongRate.Mark(1)
+	}
+	if m.SNR() < WeakSNR {
+		RtlWeakRate.Mark(1)
+	}
+}
+
+// pulsePower returns the power of the pulses of bits starting at the
+// fractional sample start, relative to full scale. Each sample averages the
+// signal over its period, so whatever their phase the magnitudes over the
+// message add up to the pulse level times the half bits the pulses fill.
+func pulsePower(mag []uint16, start float64, halfBit float64, bits int) float64 {
+	level := integrate(mag, start, start+float64(bits)*2*halfBit) / (float64(bits) * halfBit) / magFullScale
+	return level * level
+}
+
+// noisePower returns the noise power of a chunk relative to full scale. The
+// magnitude of noise is Rayleigh distributed, so its mean power is the square
+// of the median magnitude over ln 2, which unlike the mean is not thrown off
+// by the messages in the chunk.
+func noisePower(mag []uint16) float64 {
+	if len(mag) == 0 {
+		return 0
+	}
+
+	var histogram [1 << 12]int
+	for _, m := range mag {
+		histogram[m>>4]++
+	}
+
+	count := 0
+	for bin, n := range histogram {
+		if count += n; count*2 >= len(mag) {
+			median := (float64(bin) + 0.5) * 16 / magFullScale
+			return median * median / math.Ln2
+		}
+	}
+	return 0
+}
+
+// updateNoise folds the noise power of the latest chunk into the noise floor
+func (d *Demod) updateNoise(noise float64) {
+	if d.noise == 0 {
+		d.noise = noise
+	} else {
+		d.noise += noiseFloorAlpha * (noise - d.noise)
+	}
+	if d.noise > 0 {
+		RtlNoiseFloor.Update(10 * math.Log10(d.noise))
+	}
+}
@@ -0,0 +1,82 @@
+package input
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDemod_Signal(t *testing.T) {
+	// Messages are modulated at 0.6 of full scale
+	wantRssi := 20 * math.Log10(0.6)
+
+	for _, rate := range []int{DemodSampleRate, 2400000, 8000000} {
+		for _, snr := range []float64{30, 20} {
+			t.Run(fmt.Sprintf("%d at %.0f dB", rate, snr), func(t *testing.T) {
+				// Messages are far apart, as they are on air
+				quiet := sampleSignal(func(float64) bool { return false }, rate, FormatCU8)
+				var stream []byte
+				for i := 0; i < 20; i++ {
+					stream = append(stream, modulate(identMessage(0x400000+uint32(i)), rate, FormatCU8)...)
+					stream = append(stream, quiet...)
+					stream = append(stream, quiet...)
+				}
+				addNoise(stream, snr, rand.New(rand.NewSource(1)))
+
+				demod := NewDemod(2)
+				demod.SampleRate = rate
+				go func() {
+					demod.Process(NewSourceIQ(stream, len(stream)))
+					demod.Close()
+				}()
+
+				var count int
+				for msg := range demod.MessageCh {
+					count++
+					if rssi := msg.Rssi(); math.Abs(rssi-wantRssi) > 1 {
+						t.Errorf("Rssi() = %.1f dBFS, want %.1f", rssi, wantRssi)
+					}
+					if got := msg.SNR(); math.Abs(got-snr) > 2 {
+						t.Errorf("SNR() = %.1f dB, want %.0f", got, snr)
+					}
+				}
+				if count == 0 {
+					t.Fatal("no messages demodulated")
+				}
+			})
+		}
+	}
+}
+
+func TestMessage_SignalByte(t *testing.T) {
+	tests := []struct {
+		signal float64
+		want   byte
+	}{
+		{0, 0},
+		{1, 255},
+		{0.25, 128},
+		{2, 255},
+	}
+	for _, tt := range tests {
+		msg := Message{Signal: tt.signal}
+		if got := msg.SignalByte(); got != tt.want {
+			t.Errorf("SignalByte() of %v = %d, want %d", tt.signal, got, tt.want)
+		}
+	}
+}
+
+func TestDemod_UpdateNoise(t *testing.T) {
+	demod := &Demod{}
+	demod.updateNoise(0.01)
+	if demod.noise != 0.01 {
+		t.Errorf("noise floor after the first chunk = %v, want 0.01", demod.noise)
+	}
+	for i := 0; i < 200; i++ {
+		demod.updateNoise(0.001)
+	}
+	if math.Abs(demod.noise-0.001) > 0.0001 {
+		t.Errorf("noise floor = %v, want it to follow the chunks down to 0.001", demod.noise)
+	}
+}
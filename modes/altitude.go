@@ -0,0 +1,64 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import "math"
+
+// The 13 bit altitude code of replies has the pulses of a Mode C reply in the
+// order C1 A1 C2 A2 C4 A4 M B1 Q B2 D2 B4 D4. With M set the rest is the
+// altitude in metres, else with Q set in 25 ft steps from -1000 ft, and else a
+// Gillham code like Mode C. Position squitters carry the same code without M.
+const (
+	ac13MBit = 0x0040
+	ac13QBit = 0x0010
+
+	feetPerMetre = 1 / 0.3048
+)
+
+// decodeAC13Field returns the altitude in feet of the altitude code of a
+// surveillance or air-air reply, math.MaxInt32 when it is not known
+func decodeAC13Field(ac13 uint) int32 {
+	// All zero means the altitude is not available
+	if ac13 == 0 {
+		return math.MaxInt32
+	}
+
+	if ac13&ac13MBit != 0 {
+		metres := (ac13&0x1f80)>>1 | ac13&0x003f
+		return int32(math.Round(float64(metres) * feetPerMetre))
+	}
+
+	if ac13&ac13QBit != 0 {
+		/* N is the 11 bit integer resulting from the removal of bit Q and M */
+		n := (ac13&0x1f80)>>2 | (ac13&0x0020)>>1 | ac13&0x000f
+		/* The final Altitude is due to the resulting number multiplied by 25, minus 1000. */
+		return int32(n)*25 - 1000
+	}
+
+	if hundreds, ok := ModeAToModeC(decodeID13Field(ac13)); ok {
+		return hundreds * 100
+	}
+	return math.MaxInt32
+}
+
+// decodeAC12Field returns the altitude in feet of the altitude code of an
+// airborne position squitter, math.MaxInt32 when it is not known
+func decodeAC12Field(ac12Data uint) int32 {
+	if ac12Data == 0 {
+		return math.MaxInt32
+	}
+	// Put back the M bit, which is never set as the altitude is in feet
+	return decodeAC13Field((ac12Data&0x0fc0)<<1 | ac12Data&0x003f)
+}
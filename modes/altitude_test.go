@@ -0,0 +1,99 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"testing"
+)
+
+// ac13 lays out a Mode C code the way replies carry it, the reverse of
+// decodeID13Field
+func ac13(code uint) uint {
+	var field uint
+	for i, bit := range []uint{0x0010, 0x1000, 0x0020, 0x2000, 0x0040, 0x4000, 0, 0x0100, 0x0001, 0x0200, 0x0002, 0x0400, 0x0004} {
+		if code&bit != 0 {
+			field |= 0x1000 >> uint(i)
+		}
+	}
+	return field
+}
+
+// ac12 drops the M bit of an altitude code
+func ac12(field uint) uint {
+	return (field&0x1f80)>>1 | field&0x003f
+}
+
+func TestDecodeAC13Field(t *testing.T) {
+	tests := []struct {
+		name string
+		ac13 uint
+		want int32
+	}{
+		{"25 ft steps", 0x1690, 35000},
+		{"25 ft steps, lowest", 0x0010, -1000},
+		{"25 ft steps, odd", 0x1691, 35025},
+		{"metres", 0x07e8, 3281}, // 1000 m
+		{"metres, highest", 0x1fff, 13435},
+		{"Gillham -1000 ft", ac13(gillham(-10)), -1000},
+		{"Gillham 2000 ft", ac13(gillham(20)), 2000},
+		{"Gillham 126700 ft", ac13(gillham(1267)), 126700},
+		{"not available", 0, math.MaxInt32},
+		{"Gillham without C pulses", ac13(0x1200), math.MaxInt32},
+		{"Gillham invalid 100 ft step", ac13(0x0050), math.MaxInt32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAC13Field(tt.ac13); got != tt.want {
+				t.Errorf("decodeAC13Field(%04x) = %d, want %d", tt.ac13, got, tt.want)
+			}
+		})
+	}
+
+	for hundreds := -12; hundreds <= 1267; hundreds++ {
+		field := ac13(gillham(hundreds))
+		if got := decodeAC13Field(field); got != int32(hundreds)*100 {
+			t.Errorf("decodeAC13Field(%04x) = %d, want %d", field, got, hundreds*100)
+		}
+	}
+}
+
+func TestDecodeAC12Field(t *testing.T) {
+	tests := []struct {
+		name string
+		ac12 uint
+		want int32
+	}{
+		{"25 ft steps", 0x0c38, 38000}, // 8D40621D58C382D690C8AC2863A7
+		{"25 ft steps, lowest", 0x0010, -1000},
+		{"Gillham 2000 ft", ac12(ac13(gillham(20))), 2000},
+		{"not available", 0, math.MaxInt32},
+		{"Gillham without C pulses", ac12(ac13(0x1200)), math.MaxInt32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAC12Field(tt.ac12); got != tt.want {
+				t.Errorf("decodeAC12Field(%03x) = %d, want %d", tt.ac12, got, tt.want)
+			}
+		})
+	}
+
+	for hundreds := -12; hundreds <= 1267; hundreds++ {
+		field := ac12(ac13(gillham(hundreds)))
+		if got := decodeAC12Field(field); got != int32(hundreds)*100 {
+			t.Errorf("decodeAC12Field(%03x) = %d, want %d", field, got, hundreds*100)
+		}
+	}
+}
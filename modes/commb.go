@@ -0,0 +1,591 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// A Comm-B reply does not say which register its MB field holds, as the
+// interrogation asked for it. Only some registers start with their number, so
+// the MB field is checked against the layout of each: fields flagged as not
+// available must be zero, reserved bits must be zero and values must be
+// plausible. Each layout that fits scores the bits it accounts for, and what
+// is known of the aircraft raises or rules out the candidates.
+const (
+	BDS10 = 0x10 // Data link capability
+	BDS17 = 0x17 // Common usage GICB capability
+	BDS20 = 0x20 // Aircraft identification
+	BDS30 = 0x30 // ACAS active resolution advisory
+	BDS40 = 0x40 // Selected vertical intention
+	BDS50 = 0x50 // Track and turn
+	BDS60 = 0x60 // Heading and speed
+
+	// Registers decoded with less confidence are not applied to the aircraft
+	minCommBConfidence = 0.6
+	// Score, roughly the bits checked, of a register that is trusted on its
+	// own. Those that check fewer have less confidence even when no other
+	// register fits.
+	trustedCommBScore = 20
+)
+
+// gicbRegisters are the registers announced by the first 24 bits of BDS 1,7
+var gicbRegisters = [...]uint8{
+	0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x20, 0x21, 0x40, 0x41, 0x42, 0x43,
+	0x44, 0x45, 0x48, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x5f, 0x60,
+}
+
+// CommBRegister is a decoded Comm-B register, one of *DataLinkCapability,
+// *GICBCapability, *AircraftIdentification, *ACASResolution,
+// *VerticalIntention, *TrackAndTurn or *HeadingAndSpeed. Fields that are not
+// available are math.MaxInt32 or math.MaxFloat64.
+type CommBRegister interface {
+	BDS() uint8
+}
+
+// DataLinkCapability is BDS 1,0
+type DataLinkCapability struct {
+	Overlay       bool // Overlay command capability
+	SubnetVersion uint8
+}
+
+// GICBCapability is BDS 1,7, the registers the transponder supports
+type GICBCapability struct {
+	Registers []uint8
+}
+
+// AircraftIdentification is BDS 2,0
+type AircraftIdentification struct {
+	Callsign string
+}
+
+// ACASResolution is BDS 3,0. ARA holds the 14 active resolution advisory
+// bits, the first in the most significant bit.
+type ACASResolution struct {
+	ARA            uint16
+	RAC            uint8 // Resolution advisory complements
+	Terminated     bool
+	MultipleThreat bool
+	ThreatType     uint8  // 1 for an address, 2 for a position
+	ThreatAddr     uint32 // When ThreatType is 1
+}
+
+// VerticalIntention is BDS 4,0
+type VerticalIntention struct {
+	MCPAltitude int32   // ft
+	FMSAltitude int32   // ft
+	BaroSetting float64 // mb
+}
+
+// TrackAndTurn is BDS 5,0
+type TrackAndTurn struct {
+	Roll        float64 // Degrees, negative is left wing down
+	TrueTrack   float64 // Degrees
+	GroundSpeed int32   // kt
+	TrackRate   float64 // Degrees per second
+	TAS         int32   // kt
+}
+
+// HeadingAndSpeed is BDS 6,0
+type HeadingAndSpeed struct {
+	MagHeading   float64 // Degrees
+	IAS          int32   // kt
+	Mach         float64
+	BaroRate     int32 // ft/min
+	InertialRate int32 // ft/min
+}
+
+func (*DataLinkCapability) BDS() uint8     { return BDS10 }
+func (*GICBCapability) BDS() uint8         { return BDS17 }
+func (*AircraftIdentification) BDS() uint8 { return BDS20 }
+func (*ACASResolution) BDS() uint8         { return BDS30 }
+func (*VerticalIntention) BDS() uint8      { return BDS40 }
+func (*TrackAndTurn) BDS() uint8           { return BDS50 }
+func (*HeadingAndSpeed) BDS() uint8        { return BDS60 }
+
+// CommBCandidate is a register an MB field may hold. Confidence is its share
+// of the scores of all candidates, less when its own score is below
+// trustedCommBScore.
+type CommBCandidate struct {
+	Register   CommBRegister
+	Score      int
+	Confidence float64
+}
+
+// CommBReference is what is already known of the aircraft, to tell apart
+// registers with similar layouts. Altitude is math.MaxInt32 and GroundSpeed 0
+// when not known.
+type CommBReference struct {
+	Altitude    int32 // ft
+	GroundSpeed int32 // kt
+	Track       int32 // Degrees, known with GroundSpeed
+	Callsign    string
+}
+
+// mbField holds the 56 bits of an MB field, or the ME field of an extended
+// squitter, bit 1 being the most significant
+type mbField uint64
+
+func newMBField(mb [7]byte) mbField {
+	var f mbField
+	for _, b := range mb {
+		f = f<<8 | mbField(b)
+	}
+	return f
+}
+
+// bits returns bits first to last, numbered from 1
+func (f mbField) bits(first, last uint) uint32 {
+	return uint32(f>>(56-last)) & (1<<(last-first+1) - 1)
+}
+
+func (f mbField) bit(n uint) bool {
+	return f.bits(n, n) == 1
+}
+
+// signed returns bits first to last as a two's complement number whose sign
+// is bit sign
+func (f mbField) signed(sign, first, last uint) int32 {
+	v := int32(f.bits(first, last))
+	if f.bit(sign) {
+		v -= 1 << (last - first + 1)
+	}
+	return v
+}
+
+// status checks a field whose value in bits first to last is flagged by the
+// status bit. The value of a field that is not available must be zero.
+func (f mbField) status(bit, first, last uint) (available bool, ok bool) {
+	if f.bit(bit) {
+		return true, true
+	}
+	return false, f.bits(first, last) == 0
+}
+
+// DecodeCommB returns the registers the MB field of a Comm-B reply may hold,
+// most likely first
+func DecodeCommB(mb [7]byte, ref CommBReference) []CommBCandidate {
+	f := newMBField(mb)
+	if f == 0 {
+		return nil
+	}
+
+	var candidates []CommBCandidate
+	for _, decode := range []func(mbField, CommBReference) (CommBRegister, int){
+		decodeBDS10, decodeBDS17, decodeBDS20, decodeBDS30, decodeBDS40, decodeBDS50, decodeBDS60,
+	} {
+		if register, score := decode(f, ref); score > 0 {
+			candidates = append(candidates, CommBCandidate{Register: register, Score: score})
+		}
+	}
+
+	total := 0
+	for _, c := range candidates {
+		total += c.Score
+	}
+	for i, c := range candidates {
+		strength := math.Min(1, float64(c.Score)/trustedCommBScore)
+		candidates[i].Confidence = float64(c.Score) / float64(total) * strength
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	return candidates
+}
+
+func decodeBDS10(f mbField, ref CommBReference) (CommBRegister, int) {
+	if f.bits(1, 8) != 0x10 || f.bits(10, 14) != 0 {
+		return nil, 0
+	}
+
+	r := &DataLinkCapability{Overlay: f.bit(15), SubnetVersion: uint8(f.bits(17, 23))}
+	// Overlay commands came with version 5 of the subnetwork
+	if r.Overlay != (r.SubnetVersion >= 5) {
+		return nil, 0
+	}
+	return r, 8 + 5 + 8
+}
+
+func decodeBDS17(f mbField, ref CommBReference) (CommBRegister, int) {
+	// BDS 2,0 is always supported
+	if f.bits(29, 56) != 0 || !f.bit(7) {
+		return nil, 0
+	}
+
+	r := &GICBCapability{}
+	for i, bds := range gicbRegisters {
+		if f.bit(uint(i + 1)) {
+			r.Registers = append(r.Registers, bds)
+		}
+	}
+	return r, 28 + 1
+}
+
+func decodeBDS20(f mbField, ref CommBReference) (CommBRegister, int) {
+	if f.bits(1, 8) != 0x20 {
+		return nil, 0
+	}
+
+	var callsign [8]byte
+	for i := range callsign {
+		c := f.bits(uint(9+i*6), uint(14+i*6))
+		// Only letters, digits and spaces are used
+		if !(c >= 1 && c <= 26 || c == 32 || c >= 48 && c <= 57) {
+			return nil, 0
+		}
+		callsign[i] = aisChars[c]
+	}
+
+	r := &AircraftIdentification{Callsign: strings.TrimSpace(string(callsign[:]))}
+	if r.Callsign == "" {
+		return nil, 0
+	}
+	score := 8 + 48
+	if ref.Callsign != "" && ref.Callsign == r.Callsign {
+		score += 56
+	}
+	return r, score
+}
+
+func decodeBDS30(f mbField, ref CommBReference) (CommBRegister, int) {
+	// Threat type 3 is not assigned and the last ARA bits are reserved
+	if f.bits(1, 8) != 0x30 || f.bits(29, 30) == 3 || f.bits(16, 22) >= 48 {
+		return nil, 0
+	}
+
+	r := decodeRA(f)
+	score := 8 + 2
+	// Without threat identity data the rest of the field is zero
+	if r.ThreatType == 0 && f.bits(31, 56) == 0 {
+		score += 26
+	}
+	return &r, score
+}
+
+// decodeRA reads the resolution advisory in bits 9 to 56, laid out the same in
+// the ES aircraft status
+func decodeRA(f mbField) ACASResolution {
+	r := ACASResolution{
+		ARA:            uint16(f.bits(9, 22)),
+		RAC:            uint8(f.bits(23, 26)),
+		Terminated:     f.bit(27),
+		MultipleThreat: f.bit(28),
+		ThreatType:     uint8(f.bits(29, 30)),
+	}
+	if r.ThreatType == 1 {
+		r.ThreatAddr = f.bits(31, 54)
+	}
+	return r
+}
+
+// Advisory describes the resolution advisory, empty when there is none
+func (r *ACASResolution) Advisory() string {
+	ara := func(n uint) bool { return r.ARA&(1<<(54-n)) != 0 } // ARA bits 41 to 54
+
+	if ara(41) {
+		// One threat, or all in the same sense
+		var advisory string
+		down := ara(43)
+		switch {
+		case ara(47) && down:
+			advisory = "descend"
+		case ara(47):
+			advisory = "climb"
+		case down:
+			advisory = "don't climb"
+		default:
+			advisory = "don't descend"
+		}
+		if ara(44) {
+			advisory = "increase " + advisory
+		}
+		if ara(46) {
+			advisory += ", crossing"
+		}
+		if ara(45) {
+			advisory += ", reversal"
+		}
+		return advisory
+	}
+
+	if !r.MultipleThreat {
+		return ""
+	}
+	var advisories []string
+	if ara(43) {
+		advisories = append(advisories, "climb")
+	} else if ara(42) {
+		advisories = append(advisories, "correct upwards")
+	}
+	if ara(45) {
+		advisories = append(advisories, "descend")
+	} else if ara(44) {
+		advisories = append(advisories, "correct downwards")
+	}
+	if ara(46) {
+		advisories = append(advisories, "crossing")
+	}
+	if ara(47) {
+		advisories = append(advisories, "reversal")
+	}
+	return strings.Join(advisories, ", ")
+}
+
+func decodeBDS40(f mbField, ref CommBReference) (CommBRegister, int) {
+	// Reserved
+	if f.bits(40, 47) != 0 || f.bits(52, 53) != 0 {
+		return nil, 0
+	}
+
+	r := &VerticalIntention{MCPAltitude: math.MaxInt32, FMSAltitude: math.MaxInt32, BaroSetting: math.MaxFloat64}
+	score := 8 + 2
+	fields := 0
+
+	available, ok := f.status(1, 2, 13)
+	if !ok {
+		return nil, 0
+	} else if available {
+		r.MCPAltitude = int32(f.bits(2, 13)) * 16
+		score += 13
+		fields++
+		// Selected altitudes are round
+		if r.MCPAltitude%500 < 16 || r.MCPAltitude%500 > 500-16 {
+			score += 10
+		}
+	}
+
+	if available, ok = f.status(14, 15, 26); !ok {
+		return nil, 0
+	} else if available {
+		r.FMSAltitude = int32(f.bits(15, 26)) * 16
+		score += 13
+		fields++
+	}
+
+	if available, ok = f.status(27, 28, 39); !ok {
+		return nil, 0
+	} else if available {
+		r.BaroSetting = float64(f.bits(28, 39))*0.1 + 800
+		score += 13
+		fields++
+	}
+
+	// Autopilot modes and target altitude source
+	if _, ok = f.status(48, 49, 51); !ok {
+		return nil, 0
+	}
+	if _, ok = f.status(54, 55, 56); !ok {
+		return nil, 0
+	}
+
+	if fields == 0 || r.MCPAltitude != math.MaxInt32 && r.MCPAltitude > 50000 {
+		return nil, 0
+	}
+	return r, score
+}
+
+func decodeBDS50(f mbField, ref CommBReference) (CommBRegister, int) {
+	r := &TrackAndTurn{Roll: math.MaxFloat64, TrueTrack: math.MaxFloat64, GroundSpeed: math.MaxInt32,
+		TrackRate: math.MaxFloat64, TAS: math.MaxInt32}
+	score := 0
+
+	available, ok := f.status(1, 3, 11)
+	if !ok {
+		return nil, 0
+	} else if available {
+		r.Roll = float64(f.signed(2, 3, 11)) * 45 / 256
+		if math.Abs(r.Roll) > 50 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if available, ok = f.status(12, 13, 23); !ok {
+		return nil, 0
+	} else if available {
+		r.TrueTrack = float64(f.signed(13, 14, 23)) * 90 / 512
+		if r.TrueTrack < 0 {
+			r.TrueTrack += 360
+		}
+		score += 12
+	}
+
+	if available, ok = f.status(24, 25, 34); !ok {
+		return nil, 0
+	} else if available {
+		r.GroundSpeed = int32(f.bits(25, 34)) * 2
+		if r.GroundSpeed > 600 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if available, ok = f.status(35, 36, 45); !ok {
+		return nil, 0
+	} else if available {
+		r.TrackRate = float64(f.signed(36, 37, 45)) * 8 / 256
+		score += 11
+	}
+
+	if available, ok = f.status(46, 47, 56); !ok {
+		return nil, 0
+	} else if available {
+		r.TAS = int32(f.bits(47, 56)) * 2
+		if r.TAS > 500 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if score == 0 {
+		return nil, 0
+	}
+	if r.GroundSpeed != math.MaxInt32 && r.TAS != math.MaxInt32 && abs32(r.TAS-r.GroundSpeed) > 200 {
+		return nil, 0
+	}
+
+	// The same ground speed and track as the extended squitters
+	if ref.GroundSpeed > 0 && r.GroundSpeed != math.MaxInt32 {
+		switch diff := abs32(r.GroundSpeed - ref.GroundSpeed); {
+		case diff > 100:
+			return nil, 0
+		case diff <= 25:
+			score += 20
+		}
+	}
+	if ref.GroundSpeed > 50 && r.TrueTrack != math.MaxFloat64 {
+		switch diff := angleDiff(r.TrueTrack, float64(ref.Track)); {
+		case diff > 60:
+			return nil, 0
+		case diff <= 15:
+			score += 20
+		}
+	}
+	return r, score
+}
+
+func decodeBDS60(f mbField, ref CommBReference) (CommBRegister, int) {
+	r := &HeadingAndSpeed{MagHeading: math.MaxFloat64, IAS: math.MaxInt32, Mach: math.MaxFloat64,
+		BaroRate: math.MaxInt32, InertialRate: math.MaxInt32}
+	score := 0
+
+	available, ok := f.status(1, 2, 12)
+	if !ok {
+		return nil, 0
+	} else if available {
+		r.MagHeading = float64(f.signed(2, 3, 12)) * 90 / 512
+		if r.MagHeading < 0 {
+			r.MagHeading += 360
+		}
+		score += 12
+	}
+
+	if available, ok = f.status(13, 14, 23); !ok {
+		return nil, 0
+	} else if available {
+		r.IAS = int32(f.bits(14, 23))
+		if r.IAS > 500 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if available, ok = f.status(24, 25, 34); !ok {
+		return nil, 0
+	} else if available {
+		r.Mach = float64(f.bits(25, 34)) * 2.048 / 512
+		if r.Mach > 1 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if available, ok = f.status(35, 36, 45); !ok {
+		return nil, 0
+	} else if available {
+		r.BaroRate = f.signed(36, 37, 45) * 32
+		if abs32(r.BaroRate) > 6000 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if available, ok = f.status(46, 47, 56); !ok {
+		return nil, 0
+	} else if available {
+		r.InertialRate = f.signed(47, 48, 56) * 32
+		if abs32(r.InertialRate) > 6000 {
+			return nil, 0
+		}
+		score += 11
+	}
+
+	if score == 0 {
+		return nil, 0
+	}
+
+	// Mach and IAS agree at the altitude of the aircraft
+	if ref.Altitude != math.MaxInt32 && r.IAS != math.MaxInt32 && r.Mach != math.MaxFloat64 {
+		if diff := math.Abs(float64(r.IAS) - machToCAS(r.Mach, ref.Altitude)); diff > 20 {
+			return nil, 0
+		} else if diff <= 10 {
+			score += 20
+		}
+	}
+	// Heading is near the track, short of wind and magnetic variation
+	if ref.GroundSpeed > 50 && r.MagHeading != math.MaxFloat64 && angleDiff(r.MagHeading, float64(ref.Track)) <= 30 {
+		score += 10
+	}
+	return r, score
+}
+
+// machToCAS returns the calibrated airspeed in kt of mach at altitude ft in
+// the standard atmosphere
+func machToCAS(mach float64, altitude int32) float64 {
+	const (
+		p0 = 101325.0 // Pa
+		a0 = 340.294  // m/s
+		kt = 0.514444 // m/s
+	)
+
+	h := float64(altitude) * 0.3048
+	var t, p float64
+	if h < 11000 {
+		t = 288.15 - 0.0065*h
+		p = p0 * math.Pow(t/288.15, 5.25588)
+	} else {
+		t = 216.65
+		p = 22632 * math.Exp(-(h-11000)/6341.62)
+	}
+
+	qc := p * (math.Pow(1+0.2*mach*mach, 3.5) - 1)
+	return a0 * math.Sqrt(5*(math.Pow(qc/p0+1, 2.0/7)-1)) / kt
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// angleDiff returns the difference between two headings in degrees
+func angleDiff(a, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), 360)
+	if diff > 180 {
+		diff = 360 - diff
+	}
+	return diff
+}
@@ -0,0 +1,132 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// mb returns the MB field of a DF20 or DF21 message
+func mb(message string) [7]byte {
+	var field [7]byte
+	copy(field[:], convertToBytes(message)[4:11])
+	return field
+}
+
+func TestDecodeCommB(t *testing.T) {
+	noRef := CommBReference{Altitude: math.MaxInt32}
+
+	tests := []struct {
+		name    string
+		mb      [7]byte
+		ref     CommBReference
+		want    CommBRegister
+		minConf float64
+	}{
+		{"BDS 1,0", mb("A800178D10010080F50000D5893C"), noRef,
+			&DataLinkCapability{}, 1},
+		{"BDS 1,7", mb("A0000638FA81C10000000081A92F"), noRef,
+			&GICBCapability{Registers: []uint8{0x05, 0x06, 0x07, 0x08, 0x09, 0x20, 0x40, 0x50, 0x51, 0x52, 0x60}}, 1},
+		{"BDS 2,0", mb("A000083E202CC371C31DE0AA1CCF"), noRef,
+			&AircraftIdentification{Callsign: "KLM1017"}, 1},
+		{"BDS 3,0", [7]byte{0x30, 0x82}, noRef,
+			&ACASResolution{ARA: 0x2080}, minCommBConfidence},
+		{"BDS 4,0", mb("A000029C85E42F313000007047D3"), noRef,
+			&VerticalIntention{MCPAltitude: 3008, FMSAltitude: 3008, BaroSetting: 1020}, 1},
+		{"BDS 5,0", mb("A000139381951536E024D4CCF6B5"), noRef,
+			&TrackAndTurn{Roll: 2.109375, TrueTrack: 114.2578125, GroundSpeed: 438, TrackRate: 0.125, TAS: 424}, 1},
+		{"BDS 5,0 matching the squitters", mb("A000139381951536E024D4CCF6B5"),
+			CommBReference{Altitude: 35000, GroundSpeed: 440, Track: 115},
+			&TrackAndTurn{Roll: 2.109375, TrueTrack: 114.2578125, GroundSpeed: 438, TrackRate: 0.125, TAS: 424}, 1},
+		{"BDS 6,0", mb("A00004128F39F91A7E27C46ADC21"), noRef,
+			&HeadingAndSpeed{MagHeading: 42.71484375, IAS: 252, Mach: 0.42, BaroRate: -1920, InertialRate: -1920}, 1},
+		{"BDS 6,0 matching the altitude", mb("A00004128F39F91A7E27C46ADC21"),
+			CommBReference{Altitude: 6000},
+			&HeadingAndSpeed{MagHeading: 42.71484375, IAS: 252, Mach: 0.42, BaroRate: -1920, InertialRate: -1920}, 1},
+		{"BDS 5,0 against the squitters", mb("A000139381951536E024D4CCF6B5"),
+			CommBReference{Altitude: 35000, GroundSpeed: 250, Track: 115}, nil, 0},
+		{"BDS 6,0 against the altitude", mb("A00004128F39F91A7E27C46ADC21"),
+			CommBReference{Altitude: 38000}, nil, 0},
+		{"empty", [7]byte{}, noRef, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := DecodeCommB(tt.mb, tt.ref)
+			if tt.want == nil {
+				for _, c := range candidates {
+					if c.Register.BDS() == BDS50 || c.Register.BDS() == BDS60 || tt.mb == [7]byte{} {
+						t.Errorf("DecodeCommB() = %+v, want none", c.Register)
+					}
+				}
+				return
+			}
+			if len(candidates) == 0 {
+				t.Fatalf("DecodeCommB() = none, want %+v", tt.want)
+			}
+			if best := candidates[0]; !reflect.DeepEqual(best.Register, tt.want) || best.Confidence < tt.minConf {
+				t.Errorf("DecodeCommB() = %+v (%.2f), want %+v (%.2f)", best.Register, best.Confidence, tt.want, tt.minConf)
+			}
+		})
+	}
+}
+
+func TestDecodeCommB_Ambiguous(t *testing.T) {
+	// Fits both 5,0 and 6,0 equally well until the squitters tell them apart
+	field := [7]byte{0x8a, 0x5b, 0xdf, 0x2c, 0x7f, 0xc4, 0x84}
+
+	candidates := DecodeCommB(field, CommBReference{Altitude: math.MaxInt32})
+	if len(candidates) != 2 || candidates[0].Confidence >= minCommBConfidence {
+		t.Errorf("DecodeCommB() without reference = %+v, want two below %.1f", candidates, minCommBConfidence)
+	}
+
+	candidates = DecodeCommB(field, CommBReference{Altitude: 30000, GroundSpeed: 350, Track: 265})
+	if len(candidates) == 0 || candidates[0].Register.BDS() != BDS50 || candidates[0].Confidence < minCommBConfidence {
+		t.Errorf("DecodeCommB() with reference = %+v, want BDS 5,0", candidates)
+	}
+}
+
+func TestDecodeCommB_Weak(t *testing.T) {
+	// Fits only BDS 3,0, but its threat identity leaves little to check
+	field := [7]byte{0x30, 0x82, 0, 0x08, 0x12, 0x34, 0x56}
+
+	candidates := DecodeCommB(field, CommBReference{Altitude: math.MaxInt32})
+	if len(candidates) != 1 || candidates[0].Register.BDS() != BDS30 || candidates[0].Confidence >= minCommBConfidence {
+		t.Errorf("DecodeCommB() = %+v, want BDS 3,0 below %.1f", candidates, minCommBConfidence)
+	}
+}
+
+func TestACASResolution_Advisory(t *testing.T) {
+	tests := []struct {
+		name string
+		ra   ACASResolution
+		want string
+	}{
+		{"climb", ACASResolution{ARA: 0x2080}, "climb"},
+		{"increase descend", ACASResolution{ARA: 0x2c80}, "increase descend"},
+		{"don't climb, crossing", ACASResolution{ARA: 0x2900}, "don't climb, crossing"},
+		{"don't descend", ACASResolution{ARA: 0x2000}, "don't descend"},
+		{"multiple threats", ACASResolution{ARA: 0x0c00, MultipleThreat: true}, "climb, correct downwards"},
+		{"none", ACASResolution{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ra.Advisory(); got != tt.want {
+				t.Errorf("Advisory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,8 +16,146 @@ package modes
 
 import (
 	"math"
+	"time"
 )
 
+// Positions are encoded in 17 bit fractions of a zone
+const cprMax = 131072.0
+
+// Even and odd positions further apart than these may be from different zones
+const (
+	cprAirbornePairTimeout = 10 * time.Second
+	cprSurfacePairTimeout  = 50 * time.Second
+)
+
+// CPRRef is a position near an aircraft, which resolves a single CPR position
+// or the quadrant of a surface position pair
+type CPRRef struct {
+	Lat float64
+	Lon float64
+}
+
+// cprMod is the modulo whose result has the sign of b
+func cprMod(a, b float64) float64 {
+	r := math.Mod(a, b)
+	if r < 0 {
+		r += b
+	}
+	return r
+}
+
+// cprDlat is the latitude zone size of even or odd positions
+func cprDlat(odd, surface bool) float64 {
+	zones := 60.0
+	if odd {
+		zones = 59
+	}
+	if surface {
+		return 90 / zones
+	}
+	return 360 / zones
+}
+
+// decodeGlobalCPR decodes an even and odd position pair without a reference,
+// giving the position of the one heard last. Surface positions resolve to four
+// quadrants, so they need ref to pick one; ok is false when it is nil or the
+// pair straddles a zone boundary.
+func decodeGlobalCPR(even, odd CPR, oddLast, surface bool, ref *CPRRef) (lat, lon float64, ok bool) {
+	if surface && ref == nil {
+		return 0, 0, false
+	}
+
+	lat0 := float64(even.RawLat) / cprMax
+	lat1 := float64(odd.RawLat) / cprMax
+	lon0 := float64(even.RawLon) / cprMax
+	lon1 := float64(odd.RawLon) / cprMax
+
+	// Latitude index
+	j := math.Floor(59*lat0 - 60*lat1 + 0.5)
+	rlat0 := cprDlat(false, surface) * (cprMod(j, 60) + lat0)
+	rlat1 := cprDlat(true, surface) * (cprMod(j, 59) + lat1)
+
+	if surface {
+		rlat0 = surfaceQuadrant(rlat0, ref.Lat)
+		rlat1 = surfaceQuadrant(rlat1, ref.Lat)
+	} else {
+		if rlat0 >= 270 {
+			rlat0 -= 360
+		}
+		if rlat1 >= 270 {
+			rlat1 -= 360
+		}
+	}
+	if rlat0 < -90 || rlat0 > 90 || rlat1 < -90 || rlat1 > 90 {
+		return 0, 0, false
+	}
+	// The positions are in different longitude zones
+	if cprnl(rlat0) != cprnl(rlat1) {
+		return 0, 0, false
+	}
+
+	lat, rlon := rlat0, lon0
+	if oddLast {
+		lat, rlon = rlat1, lon1
+	}
+	nl := float64(cprnl(lat))
+	ni := float64(cprn(lat, oddLast))
+
+	// Longitude index
+	m := math.Floor(lon0*(nl-1) - lon1*nl + 0.5)
+	lon = cprDlonFunction(lat, oddLast, surface) * (cprMod(m, ni) + rlon)
+
+	if surface {
+		// The quadrant closest to the reference
+		lon += math.Floor((ref.Lon-lon+45)/90) * 90
+	}
+	lon -= math.Floor((lon+180)/360) * 360
+	return lat, lon, true
+}
+
+// surfaceQuadrant picks the northern or southern solution of a surface
+// latitude, whichever is closer to the reference
+func surfaceQuadrant(rlat, refLat float64) float64 {
+	// -90, 0 and 90 all encode as 0
+	if rlat == 0 {
+		switch {
+		case refLat < -45:
+			return -90
+		case refLat > 45:
+			return 90
+		}
+		return 0
+	}
+	if rlat-refLat > 45 {
+		return rlat - 90
+	}
+	return rlat
+}
+
+// decodeLocalCPR decodes a single position relative to ref, which must be
+// within half a zone of it: 180 NM airborne and 45 NM on the surface. ok is
+// false when the position is further than that from ref.
+func decodeLocalCPR(cpr CPR, surface bool, ref CPRRef) (lat, lon float64, ok bool) {
+	fLat := float64(cpr.RawLat) / cprMax
+	fLon := float64(cpr.RawLon) / cprMax
+
+	dlat := cprDlat(cpr.Odd, surface)
+	j := math.Floor(ref.Lat/dlat) + math.Floor(0.5+cprMod(ref.Lat, dlat)/dlat-fLat)
+	lat = dlat * (j + fLat)
+	if lat < -90 || lat > 90 || math.Abs(lat-ref.Lat) > dlat/2 {
+		return 0, 0, false
+	}
+
+	dlon := cprDlonFunction(lat, cpr.Odd, surface)
+	m := math.Floor(ref.Lon/dlon) + math.Floor(0.5+cprMod(ref.Lon, dlon)/dlon-fLon)
+	lon = dlon * (m + fLon)
+	if math.Abs(lon-ref.Lon) > dlon/2 {
+		return 0, 0, false
+	}
+	lon -= math.Floor((lon+180)/360) * 360
+	return lat, lon, true
+}
+
 func cprnl(lat float64) byte {
 	if lat < 0 { lat = -lat }
 	switch {
@@ -165,14 +303,3 @@ func cprDlonFunction(lat float64, fflag bool, surface bool) float64 {
 	return sfc / float64(cprn(lat, fflag))
 
 }
-
-func decodeAC12Field(ac12Data uint) int32 {
-	q := (ac12Data & 0x10) == 0x10
-	if q {
-		n := int32((ac12Data&0x0FE0)>>1) + int32(ac12Data&0x000F)
-		return (n * 25) - 1000
-	} else {
-		/* Gillham coded Altitude */
-		return int32(math.MaxInt32)
-	}
-}
@@ -0,0 +1,157 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/types"
+	"github.com/kellydunn/golang-geo"
+)
+
+// The test vectors are those of "The 1090 Megahertz Riddle" and of pyModeS
+
+func cprOf(message string) CPR {
+	return decodeCPR(convertToBytes(message))
+}
+
+// near compares positions to the five decimals the vectors are given with
+func near(lat, lon, wantLat, wantLon float64) bool {
+	return math.Abs(lat-wantLat) < 0.00001 && math.Abs(lon-wantLon) < 0.00001
+}
+
+func TestDecodeGlobalCPR(t *testing.T) {
+	tests := []struct {
+		name             string
+		even, odd        string
+		oddLast, surface bool
+		ref              *CPRRef
+		wantLat, wantLon float64
+		wantOK           bool
+	}{
+		{"airborne, even last", "8D40621D58C382D690C8AC2863A7", "8D40621D58C386435CC412692AD6", false, false, nil,
+			52.25720, 3.91937, true},
+		{"airborne, odd last", "8D40621D58C382D690C8AC2863A7", "8D40621D58C386435CC412692AD6", true, false, nil,
+			52.26578, 3.93891, true},
+		{"airborne, odd last 2", "8D40058B58C901375147EFD09357", "8D40058B58C904A87F402D3B8C59", true, false, nil,
+			49.81755, 6.08442, true},
+		{"surface", "8C4841753AAB238733C8CD4020B1", "8C4841753A8A35323FAEBDAC702D", true, true, &CPRRef{51.990, 4.375},
+			52.32061, 4.73473, true},
+		{"surface, southern hemisphere", "8CC8200A3AC8F009BCDEF2000000", "8FC8200A3AB8F5F893096B000000", true, true, &CPRRef{-43.496, 172.558},
+			-43.48564, 172.53942, true},
+		{"surface, no reference", "8C4841753AAB238733C8CD4020B1", "8C4841753A8A35323FAEBDAC702D", true, true, nil,
+			0, 0, false},
+		{"straddling zones", "8D40621D58C382D690C8AC2863A7", "8D40058B58C904A87F402D3B8C59", true, false, nil,
+			0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, ok := decodeGlobalCPR(cprOf(tt.even), cprOf(tt.odd), tt.oddLast, tt.surface, tt.ref)
+			if ok != tt.wantOK || ok && !near(lat, lon, tt.wantLat, tt.wantLon) {
+				t.Errorf("decodeGlobalCPR() = %.5f, %.5f, %t, want %.5f, %.5f, %t", lat, lon, ok, tt.wantLat, tt.wantLon, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDecodeLocalCPR(t *testing.T) {
+	tests := []struct {
+		name             string
+		message          string
+		surface          bool
+		ref              CPRRef
+		wantLat, wantLon float64
+		wantOK           bool
+	}{
+		{"airborne even", "8D40621D58C382D690C8AC2863A7", false, CPRRef{52.258, 3.918}, 52.25720, 3.91937, true},
+		{"airborne even 2", "8D40058B58C901375147EFD09357", false, CPRRef{49.0, 6.0}, 49.82410, 6.06785, true},
+		{"airborne odd", "8D40058B58C904A87F402D3B8C59", false, CPRRef{49.0, 6.0}, 49.81755, 6.08442, true},
+		{"surface", "8C4841753A8A35323FAEBDAC702D", true, CPRRef{51.990, 4.375}, 52.32061, 4.73473, true},
+		{"surface, southern hemisphere", "8FC8200A3AB8F5F893096B000000", true, CPRRef{-43.496, 172.558}, -43.48564, 172.53942, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, ok := decodeLocalCPR(cprOf(tt.message), tt.surface, tt.ref)
+			if ok != tt.wantOK || ok && !near(lat, lon, tt.wantLat, tt.wantLon) {
+				t.Errorf("decodeLocalCPR() = %.5f, %.5f, %t, want %.5f, %.5f, %t", lat, lon, ok, tt.wantLat, tt.wantLon, tt.wantOK)
+			}
+		})
+	}
+
+	// The zone nearest the reference puts the position beyond the pole
+	if lat, lon, ok := decodeLocalCPR(CPR{RawLat: 13107}, false, CPRRef{89.9, 0}); ok {
+		t.Errorf("decodeLocalCPR() = %.5f, %.5f beyond the pole", lat, lon)
+	}
+}
+
+func TestTracker_updatePosition(t *testing.T) {
+	newAircraft := func() *types.AircraftData {
+		return &types.AircraftData{ERawLat: math.MaxUint32, ERawLon: math.MaxUint32, ORawLat: math.MaxUint32,
+			ORawLon: math.MaxUint32, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64}
+	}
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+
+	// A pair further apart than 10 s airborne is not decoded
+	aircraft := newAircraft()
+	tracker.updatePosition(aircraft, cprOf("8D40621D58C382D690C8AC2863A7"), false, nil)
+	aircraft.ERawTime = aircraft.ERawTime.Add(-11 * time.Second)
+	tracker.updatePosition(aircraft, cprOf("8D40621D58C386435CC412692AD6"), false, nil)
+	if aircraft.Latitude != math.MaxFloat64 {
+		t.Errorf("updatePosition() = %.5f, %.5f from a stale pair", aircraft.Latitude, aircraft.Longitude)
+	}
+
+	// Once the position is known single positions are decoded relative to it
+	aircraft.ERawTime = aircraft.ORawTime
+	tracker.updatePosition(aircraft, cprOf("8D40621D58C386435CC412692AD6"), false, nil)
+	if !near(aircraft.Latitude, aircraft.Longitude, 52.26578, 3.93891) {
+		t.Fatalf("updatePosition() = %.5f, %.5f, want 52.26578, 3.93891", aircraft.Latitude, aircraft.Longitude)
+	}
+	aircraft.ERawTime = aircraft.ERawTime.Add(-time.Minute)
+	aircraft.LastPos = aircraft.LastPos.Add(-10 * time.Second) // Time to fly between them
+	tracker.updatePosition(aircraft, cprOf("8D40621D58C382D690C8AC2863A7"), false, nil)
+	if !near(aircraft.Latitude, aircraft.Longitude, 52.25720, 3.91937) {
+		t.Errorf("updatePosition() = %.5f, %.5f, want 52.25720, 3.91937", aircraft.Latitude, aircraft.Longitude)
+	}
+
+	// Surface positions pair for 50 s, in the quadrant of the receiver
+	aircraft = newAircraft()
+	tracker.updatePosition(aircraft, cprOf("8C4841753AAB238733C8CD4020B1"), true, nil)
+	aircraft.ERawTime = aircraft.ERawTime.Add(-45 * time.Second)
+	tracker.updatePosition(aircraft, cprOf("8C4841753A8A35323FAEBDAC702D"), true, nil)
+	if aircraft.Latitude != math.MaxFloat64 {
+		t.Errorf("updatePosition() = %.5f, %.5f on the surface without a reference", aircraft.Latitude, aircraft.Longitude)
+	}
+	tracker = NewTracker(types.NewAircraftMap(), &config.BeastInfo{Homepos: geo.NewPoint(51.990, 4.375)})
+	tracker.updatePosition(aircraft, cprOf("8C4841753A8A35323FAEBDAC702D"), true, nil)
+	if !near(aircraft.Latitude, aircraft.Longitude, 52.32061, 4.73473) || !aircraft.Surface {
+		t.Errorf("updatePosition() = %.5f, %.5f, want 52.32061, 4.73473 on the surface", aircraft.Latitude, aircraft.Longitude)
+	}
+
+	// Airborne halves do not pair with surface ones
+	tracker.updatePosition(aircraft, cprOf("8D40621D58C382D690C8AC2863A7"), false, nil)
+	if aircraft.Surface || aircraft.ORawLat != math.MaxUint32 {
+		t.Errorf("updatePosition() kept the surface odd position %d in the air", aircraft.ORawLat)
+	}
+
+	// Nor is the airborne ground speed kept on landing
+	aircraft.Speed = 140
+	tracker.updatePosition(aircraft, cprOf("8C4841753A8A35323FAEBDAC702D"), true, nil)
+	if aircraft.Speed != 0 {
+		t.Errorf("updatePosition() kept %d kt on the surface", aircraft.Speed)
+	}
+}
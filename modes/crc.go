@@ -0,0 +1,146 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import "sync"
+
+// The CRC is linear, so the syndrome of a damaged message is the syndrome of
+// the error alone, the xor of the syndromes of each flipped bit. Looking the
+// syndrome up in a table of every single and double bit error tells which bits
+// to flip back without trying them one by one.
+const (
+	// MaxCRCFix is the most bits FixCRC corrects in a message
+	MaxCRCFix = 2
+
+	// The DF field is never corrected, a message with a damaged DF would be
+	// checked against the wrong length
+	crcFirstFixBit = 5
+
+	// DF11 carries the interrogator code in the low bits of its parity
+	iidMask = 0x7f
+)
+
+type bitError struct {
+	bits [MaxCRCFix]int
+	n    int // 0 when two errors share the syndrome
+}
+
+// Built on first use, after init has filled crcTable
+var (
+	crcSyndromes56  map[uint32]bitError
+	crcSyndromes112 map[uint32]bitError
+	syndromesOnce   sync.Once
+)
+
+func buildSyndromes() {
+	crcSyndromes56 = syndromeTable(56)
+	crcSyndromes112 = syndromeTable(112)
+}
+
+// syndromeTable maps the syndrome of each single and double bit error in a
+// message of the given length to its bits
+func syndromeTable(bits int) map[uint32]bitError {
+	single := make([]uint32, bits)
+	msg := make([]byte, bits/8)
+	for i := crcFirstFixBit; i < bits; i++ {
+		msg[i/8] = 0x80 >> uint(i%8)
+		single[i] = modesChecksum(msg, uint(bits))
+		msg[i/8] = 0
+	}
+
+	table := make(map[uint32]bitError)
+	add := func(syndrome uint32, e bitError) {
+		if _, ok := table[syndrome]; ok {
+			table[syndrome] = bitError{}
+			return
+		}
+		table[syndrome] = e
+	}
+	for i := crcFirstFixBit; i < bits; i++ {
+		add(single[i], bitError{bits: [MaxCRCFix]int{i}, n: 1})
+		for j := i + 1; j < bits; j++ {
+			add(single[i]^single[j], bitError{bits: [MaxCRCFix]int{i, j}, n: 2})
+		}
+	}
+	return table
+}
+
+// FixCRC checks the parity of DF11, DF17 and DF18 messages, whose parity is
+// not overlaid with an address, and corrects up to maxFix bad bits in place.
+// It returns the number of bits corrected and whether the message is valid.
+// Other downlink formats can not be checked and pass unchanged.
+func FixCRC(message []byte, maxFix int) (int, bool) {
+	if len(message) == 0 {
+		return 0, false
+	}
+	if maxFix > MaxCRCFix {
+		maxFix = MaxCRCFix
+	}
+	syndromesOnce.Do(buildSyndromes)
+
+	switch message[0] >> 3 {
+	case 11:
+		if len(message) != 7 {
+			return 0, false
+		}
+		return fixDF11(message, maxFix)
+	case 17, 18:
+		if len(message) != 14 {
+			return 0, false
+		}
+		syndrome := modesChecksum(message, 112)
+		if syndrome == 0 {
+			return 0, true
+		}
+		e, ok := crcSyndromes112[syndrome]
+		if !ok || e.n == 0 || e.n > maxFix {
+			return 0, false
+		}
+		for _, bit := range e.bits[:e.n] {
+			message[bit/8] ^= 0x80 >> uint(bit%8)
+		}
+		return e.n, true
+	}
+	return 0, true
+}
+
+// fixDF11 checks an all-call reply, which is valid when only the interrogator
+// code is left in the syndrome. Unknown low bits leave too little parity to
+// correct more than a single bit, and only when one bit alone fits.
+func fixDF11(message []byte, maxFix int) (int, bool) {
+	syndrome := modesChecksum(message, 56)
+	if syndrome&^iidMask == 0 {
+		return 0, true
+	}
+	if maxFix < 1 {
+		return 0, false
+	}
+
+	bit := -1
+	for s, e := range crcSyndromes56 {
+		if e.n != 1 || (syndrome^s)&^iidMask != 0 {
+			continue
+		}
+		if bit != -1 {
+			return 0, false
+		}
+		bit = e.bits[0]
+	}
+	if bit == -1 {
+		return 0, false
+	}
+	message[bit/8] ^= 0x80 >> uint(bit%8)
+	return 1, true
+}
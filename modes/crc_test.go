@@ -0,0 +1,88 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"bytes"
+	"testing"
+)
+
+// flip returns a copy of message with the given bits inverted
+func flip(message []byte, bits ...int) []byte {
+	damaged := append([]byte(nil), message...)
+	for _, bit := range bits {
+		damaged[bit/8] ^= 0x80 >> uint(bit%8)
+	}
+	return damaged
+}
+
+func TestFixCRC(t *testing.T) {
+	es := convertToBytes("8D4840D6202CC371C32CE0576098")
+	allCall := withParity([]byte{0x5d, 0x48, 0x40, 0xd6, 0, 0, 0}, 0)
+	allCallIID := withParity([]byte{0x5d, 0x48, 0x40, 0xd6, 0, 0, 0}, 0x23)
+	surveillance := withParity([]byte{0x20, 0, 0x05, 0xa0, 0, 0, 0}, 0x4840d6)
+
+	tests := []struct {
+		name      string
+		message   []byte
+		maxFix    int
+		want      []byte
+		wantFixed int
+		wantOK    bool
+	}{
+		{"valid DF17", es, 1, es, 0, true},
+		{"DF17 one bit", flip(es, 40), 1, es, 1, true},
+		{"DF17 parity bit", flip(es, 110), 1, es, 1, true},
+		{"DF17 one bit without correction", flip(es, 40), 0, nil, 0, false},
+		{"DF17 two bits", flip(es, 12, 77), 2, es, 2, true},
+		{"DF17 two bits correcting one", flip(es, 12, 77), 1, nil, 0, false},
+		{"DF17 three bits", flip(es, 12, 40, 77), 2, nil, 0, false},
+		{"DF18 one bit", flip(withParity(flip(es, 3, 4), 0), 60), 1, withParity(flip(es, 3, 4), 0), 1, true},
+		{"DF17 short", es[:7], 1, nil, 0, false},
+		{"valid DF11", allCall, 1, allCall, 0, true},
+		{"DF11 with interrogator code", allCallIID, 1, allCallIID, 0, true},
+		{"DF11 one bit", flip(allCall, 20), 1, allCall, 1, true},
+		{"DF11 one bit without correction", flip(allCall, 20), 0, nil, 0, false},
+		{"DF11 long", withParity(append(append([]byte(nil), allCall[:4]...), make([]byte, 10)...), 0), 1, nil, 0, false},
+		{"DF4 passes unchecked", surveillance, 2, surveillance, 0, true},
+		{"empty", nil, 2, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := append([]byte(nil), tt.message...)
+			fixed, ok := FixCRC(message, tt.maxFix)
+			if fixed != tt.wantFixed || ok != tt.wantOK {
+				t.Fatalf("FixCRC(%x, %d) = %d, %t, want %d, %t", tt.message, tt.maxFix, fixed, ok, tt.wantFixed, tt.wantOK)
+			}
+			if ok && !bytes.Equal(message, tt.want) {
+				t.Errorf("FixCRC(%x, %d) corrected to %x, want %x", tt.message, tt.maxFix, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyndromeTable(t *testing.T) {
+	syndromesOnce.Do(buildSyndromes)
+
+	// Every bit outside the DF field and every pair of them
+	if got, want := len(crcSyndromes112), 107+107*106/2; got != want {
+		t.Errorf("112 bit table has %d syndromes, want %d", got, want)
+	}
+	for syndrome, e := range crcSyndromes112 {
+		if e.n == 0 {
+			t.Errorf("syndrome %06x is shared by two errors", syndrome)
+		}
+	}
+}
@@ -28,7 +28,7 @@ func Test_decodeModeS(t *testing.T) {
 		message []byte
 		isMlat  bool
 	}
-	knownAircraft := types.NewAircraftMap()
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{Debug: false})
 
 	tests := []struct {
 		name string
@@ -82,7 +82,7 @@ func Test_decodeModeS(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := DecodeModeS(tt.args.message, tt.args.isMlat, 0, knownAircraft, &config.BeastInfo{Debug: false}); !reflect.DeepEqual(got, tt.want) {
+			if got := tracker.Decode(tt.args.message, tt.args.isMlat, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("decodeModeS() = \ngot:  %#v\nwant: %#v", got, tt.want)
 			}
 		})
@@ -111,19 +111,20 @@ func Test_parseTime(t *testing.T) {
 
 func Test_decodeExtendedSquitter(t *testing.T) {
 	type args struct {
-		message  []byte
-		linkFmt  uint
-		aircraft *types.AircraftData
+		message []byte
 	}
 	tests := []struct {
 		name string
 		args args
+		want Message
 	}{
 		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			DecodeExtendedSquitter(tt.args.message, tt.args.linkFmt, tt.args.aircraft, &config.BeastInfo{Debug: false})
+			if got, _ := Decode(tt.args.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
 		})
 	}
 }
@@ -135,7 +136,6 @@ func Test_parsRawLatLon(t *testing.T) {
 		oddLat  uint32
 		oddLon  uint32
 		lastOdd bool
-		tFlag   bool
 		srfc    bool
 	}
 	tests := []struct {
@@ -148,7 +148,9 @@ func Test_parsRawLatLon(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotLatitude, gotLongitude := parsERawLatLon(tt.args.evenLat, tt.args.evenLon, tt.args.oddLat, tt.args.oddLon, tt.args.lastOdd, tt.args.tFlag, tt.args.srfc)
+			even := CPR{RawLat: tt.args.evenLat, RawLon: tt.args.evenLon}
+			odd := CPR{RawLat: tt.args.oddLat, RawLon: tt.args.oddLon, Odd: true}
+			gotLatitude, gotLongitude, _ := decodeGlobalCPR(even, odd, tt.args.lastOdd, tt.args.srfc, nil)
 			if gotLatitude != tt.wantLatitude {
 				t.Errorf("parseRawLatLon() gotLatitude = %v, want %v", gotLatitude, tt.wantLatitude)
 			}
@@ -188,3 +190,65 @@ func createTime(from string) time.Time {
 	to, _ := time.Parse(time.RFC3339, from)
 	return to
 }
+
+// withParity returns message with the address overlaid on its parity
+func withParity(message []byte, addr uint32) []byte {
+	n := len(message)
+	message[n-3], message[n-2], message[n-1] = 0, 0, 0
+	crc := modesChecksum(message, uint(n*8)) ^ addr
+	message[n-3], message[n-2], message[n-1] = byte(crc>>16), byte(crc>>8), byte(crc)
+	return message
+}
+
+func TestTracker_Decode_AddressParity(t *testing.T) {
+	const addr = 0x4840d6
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		message    []byte
+		lastES     time.Time
+		modeAC     bool
+		wantValid  bool
+		wantAlt    int32
+		wantSquawk uint32
+	}{
+		// 35000 ft is 1440 in 25 ft steps with the Q bit set
+		{"DF4 altitude", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, addr), now, false, true, 35000, 0x1200},
+		{"DF20 altitude", withParity([]byte{0xa0, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, addr), now, false, true, 35000, 0x1200},
+		{"DF5 squawk", withParity([]byte{0x28, 0, 0x0a, 0xaa, 0, 0, 0}, addr), now, false, true, 10000, 0x7700},
+		{"DF21 squawk", withParity([]byte{0xa8, 0, 0x0a, 0xaa, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, addr), now, false, true, 10000, 0x7700},
+		{"unknown address", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, 0xabcdef), now, false, false, 0, 0},
+		{"no recent extended squitter", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, addr), now.Add(-2 * time.Minute), false, false, 0, 0},
+		{"never heard in an extended squitter", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, addr), time.Time{}, false, false, 0, 0},
+		{"mode A/C target", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, addr), now, true, false, 0, 0},
+		{"long DF4", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, addr), now, false, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knownAircraft := types.NewAircraftMap()
+			knownAircraft.Store(addr, &types.AircraftData{IcaoAddr: addr, Altitude: 10000, Squawk: 0x1200,
+				LastES: tt.lastES, ModeAC: tt.modeAC, IsValid: true})
+
+			got := NewTracker(knownAircraft, &config.BeastInfo{}).Decode(tt.message, false, nil)
+			if got.IsValid != tt.wantValid {
+				t.Fatalf("Decode(%x) IsValid = %t, want %t", tt.message, got.IsValid, tt.wantValid)
+			}
+			if !tt.wantValid {
+				return
+			}
+			if got.IcaoAddr != addr || got.Altitude != tt.wantAlt || got.Squawk != tt.wantSquawk {
+				t.Errorf("Decode(%x) = %06x at %d ft squawking %04x, want %06x at %d ft squawking %04x",
+					tt.message, got.IcaoAddr, got.Altitude, got.Squawk, addr, tt.wantAlt, tt.wantSquawk)
+			}
+		})
+	}
+}
+
+func TestTracker_Decode_LastES(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+	got := tracker.Decode(convertToBytes("8da6c6c820053074db08208391f5"), false, nil)
+	if got.LastES.IsZero() {
+		t.Error("Decode() of an extended squitter did not set LastES")
+	}
+}
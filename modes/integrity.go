@@ -0,0 +1,97 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+const nm = 1852 // Metres per nautical mile
+
+// integrity is a navigation integrity category, or a NUCp for ADS-B version 0,
+// with its radius of containment in metres
+type integrity struct {
+	nic uint8
+	rc  float64
+}
+
+// nucP is the NUCp of version 0 position squitters by type code, with the
+// horizontal protection limit
+var nucP = map[uint8]integrity{
+	5: {9, 7.5}, 6: {8, 25}, 7: {6, 0.1 * nm}, 8: {0, 0},
+	9: {9, 7.5}, 10: {8, 25}, 11: {7, 0.1 * nm}, 12: {6, 0.2 * nm}, 13: {5, 0.5 * nm},
+	14: {4, 1 * nm}, 15: {3, 2 * nm}, 16: {2, 10 * nm}, 17: {1, 20 * nm}, 18: {0, 0},
+	20: {9, 7.5}, 21: {8, 25}, 22: {0, 0},
+}
+
+// positionIntegrity returns the integrity of a position squitter with type
+// code tc. The type code alone leaves some categories open, which the NIC
+// supplements of the operational status (a and c) and of the airborne position
+// (b) settle; version 1 only has supplement a.
+func positionIntegrity(tc, version uint8, a, b, c bool) integrity {
+	if version == 0 {
+		return nucP[tc]
+	}
+	if version == 1 {
+		// Supplement a alone picks the better of the two categories
+		b, c = a, false
+	}
+
+	switch tc {
+	case 5, 9, 20:
+		return integrity{11, 7.5}
+	case 6, 10, 21:
+		return integrity{10, 25}
+	case 7:
+		if a && !c {
+			return integrity{9, 75}
+		}
+		return integrity{8, 0.1 * nm}
+	case 8:
+		switch {
+		case version == 1:
+			return integrity{0, 0}
+		case a && c:
+			return integrity{7, 0.2 * nm}
+		case a:
+			return integrity{6, 0.3 * nm}
+		case c:
+			return integrity{6, 0.6 * nm}
+		}
+	case 11:
+		if a && b {
+			return integrity{9, 75}
+		}
+		return integrity{8, 0.1 * nm}
+	case 12:
+		return integrity{7, 0.2 * nm}
+	case 13:
+		switch {
+		case a && b:
+			return integrity{6, 0.6 * nm}
+		case b:
+			return integrity{6, 0.3 * nm}
+		}
+		return integrity{6, 0.5 * nm}
+	case 14:
+		return integrity{5, 1 * nm}
+	case 15:
+		return integrity{4, 2 * nm}
+	case 16:
+		if a && b {
+			return integrity{3, 4 * nm}
+		}
+		return integrity{2, 8 * nm}
+	case 17:
+		return integrity{1, 20 * nm}
+	}
+	return integrity{0, 0}
+}
@@ -0,0 +1,353 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"errors"
+	"math"
+
+	"github.com/ccustine/beastie/types"
+)
+
+var (
+	ErrLength      = errors.New("message length does not match its downlink format")
+	ErrUnsupported = errors.New("unsupported downlink format")
+)
+
+// Message is a decoded Mode S message. Its type tells the downlink format and
+// for extended squitters the type code:
+//
+//	*AltitudeReply        DF0, DF4, DF16
+//	*IdentityReply        DF5
+//	*CommBAltitudeReply   DF20
+//	*CommBIdentityReply   DF21
+//	*AllCallReply         DF11
+//	*Identification       DF17/18 TC1-4
+//	*SurfacePosition      DF17/18 TC5-8
+//	*AirbornePosition     DF17/18 TC9-18, TC20-22
+//	*AirborneVelocity     DF17/18 TC19 subtypes 1-4
+//	*AircraftStatus       DF17/18 TC28 subtype 1
+//	*RABroadcast          DF17/18 TC28 subtype 2
+//	*TargetState          DF17/18 TC29 subtype 1
+//	*OperationalStatus    DF17/18 TC31 subtypes 0-1
+//	*ExtendedSquitter     DF17/18 other type codes
+type Message interface {
+	// Format is the downlink format
+	Format() uint32
+	// Address is the ICAO address of the sender
+	Address() uint32
+	// ParityAddress reports whether the address was recovered from the
+	// parity, where any bit error yields a different address
+	ParityAddress() bool
+}
+
+// Header holds the fields every message has
+type Header struct {
+	DF         uint32
+	Addr       uint32
+	AddrParity bool
+}
+
+func (h Header) Format() uint32 { return h.DF }
+
+func (h Header) Address() uint32 { return h.Addr }
+
+func (h Header) ParityAddress() bool { return h.AddrParity }
+
+// AltitudeReply is a surveillance or air-air reply carrying the altitude.
+// Altitude is math.MaxInt32 when it is not known.
+type AltitudeReply struct {
+	Header
+	Altitude int32
+}
+
+// IdentityReply is a surveillance reply carrying the squawk, stored as the hex
+// digits of the octal code
+type IdentityReply struct {
+	Header
+	Squawk uint32
+}
+
+// CommBAltitudeReply is an altitude reply with the 56 bit MB field of a Comm-B
+// register
+type CommBAltitudeReply struct {
+	AltitudeReply
+	MB [7]byte
+}
+
+// CommBIdentityReply is an identity reply with the 56 bit MB field of a Comm-B
+// register
+type CommBIdentityReply struct {
+	IdentityReply
+	MB [7]byte
+}
+
+// AllCallReply answers an all-call with the address in the clear
+type AllCallReply struct {
+	Header
+	Capability uint8
+}
+
+// ExtendedSquitter holds the fields of every DF17 and DF18 message. CF is the
+// DF18 control field, telling ADS-B from TIS-B and ADS-R.
+type ExtendedSquitter struct {
+	Header
+	CF       uint8
+	TypeCode uint8
+	Subtype  uint8
+}
+
+// Identification is an extended squitter with the callsign and the emitter
+// category, whose set is given by the type code and the category in it by the
+// subtype
+type Identification struct {
+	ExtendedSquitter
+	Callsign string
+	Category types.EmitterCategory
+}
+
+// CPR is one half of an even/odd pair of compact position reports. T is the
+// time synchronisation flag.
+type CPR struct {
+	RawLat uint32
+	RawLon uint32
+	Odd    bool
+	T      bool
+}
+
+// SurfacePosition is an extended squitter with the position on the ground
+type SurfacePosition struct {
+	ExtendedSquitter
+	CPR
+}
+
+// AirbornePosition is an extended squitter with the position in the air.
+// Altitude is math.MaxInt32 when it is not known. NICSupplementB is the single
+// antenna flag before ADS-B version 2.
+type AirbornePosition struct {
+	ExtendedSquitter
+	CPR
+	Altitude       int32
+	NICSupplementB bool
+}
+
+// AirborneVelocity is an extended squitter with the velocity. Subtypes 1 and
+// 2 carry the ground speed and track, 3 and 4 the heading and airspeed; 2 and
+// 4 are for supersonic aircraft. Fields are math.MaxInt32 or math.MaxFloat64
+// when not available. NACv is the NUCr for ADS-B version 0, on the same scale.
+type AirborneVelocity struct {
+	ExtendedSquitter
+	NACv uint8
+
+	GroundSpeed int32   // kt
+	Track       float64 // Degrees, not available at zero ground speed
+
+	MagHeading   float64 // Degrees
+	Airspeed     int32   // kt
+	TrueAirspeed bool    // Airspeed is the TAS rather than the IAS
+
+	VertRate       int32 // ft/min, negative when descending
+	VertRateSource uint  // VertRateGNSS or VertRateBaro
+	GeomOffset     int32 // Geometric height above the barometric altitude in ft
+}
+
+// Sources of the vertical rate
+const (
+	VertRateGNSS = 0
+	VertRateBaro = 1
+)
+
+// Decode parses a Mode S message without reference to any aircraft state. The
+// address of replies that overlay it on the parity is taken from the parity, so
+// it must be checked against aircraft recently heard in the clear.
+func Decode(message []byte) (Message, error) {
+	if len(message) == 0 {
+		return nil, ErrLength
+	}
+
+	df := getbits(message, 1, 5)
+	switch df {
+	case 0, 4, 5, 11:
+		if len(message) != 7 {
+			return nil, ErrLength
+		}
+	case 16, 17, 18, 20, 21:
+		if len(message) != 14 {
+			return nil, ErrLength
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	header := Header{DF: df}
+	switch df {
+	case 11, 17, 18:
+		header.Addr = getbits(message, 9, 32)
+	default:
+		header.Addr = modesChecksum(message, uint(len(message)*8))
+		header.AddrParity = true
+	}
+
+	switch df {
+	case 0, 4, 16:
+		return &AltitudeReply{Header: header, Altitude: decodeAltitude(message)}, nil
+	case 20:
+		m := &CommBAltitudeReply{AltitudeReply: AltitudeReply{Header: header, Altitude: decodeAltitude(message)}}
+		copy(m.MB[:], message[4:11])
+		return m, nil
+	case 5:
+		return &IdentityReply{Header: header, Squawk: decodeSquawk(message)}, nil
+	case 21:
+		m := &CommBIdentityReply{IdentityReply: IdentityReply{Header: header, Squawk: decodeSquawk(message)}}
+		copy(m.MB[:], message[4:11])
+		return m, nil
+	case 11:
+		return &AllCallReply{Header: header, Capability: message[0] & 7}, nil
+	}
+
+	return decodeExtendedSquitter(message, header), nil
+}
+
+func decodeAltitude(message []byte) int32 {
+	return decodeAC13Field(uint(getbits(message, 20, 32)))
+}
+
+func decodeSquawk(message []byte) uint32 {
+	return uint32(decodeID13Field(uint(getbits(message, 20, 32))))
+}
+
+func decodeExtendedSquitter(message []byte, header Header) Message {
+	es := ExtendedSquitter{Header: header, TypeCode: message[4] >> 3}
+	if header.DF == 18 {
+		es.CF = message[0] & 7
+	}
+	if es.TypeCode == 29 {
+		es.Subtype = (message[4] & 6) >> 1
+	} else {
+		es.Subtype = message[4] & 7
+	}
+
+	switch es.TypeCode {
+	case 1, 2, 3, 4:
+		return &Identification{ExtendedSquitter: es, Callsign: parseCallsign(message),
+			Category: types.NewEmitterCategory(es.TypeCode, es.Subtype)}
+
+	case 5, 6, 7, 8:
+		return &SurfacePosition{ExtendedSquitter: es, CPR: decodeCPR(message)}
+
+	case 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 20, 21, 22:
+		m := &AirbornePosition{ExtendedSquitter: es, CPR: decodeCPR(message), Altitude: math.MaxInt32,
+			NICSupplementB: message[4]&1 != 0}
+		if es.TypeCode <= 18 {
+			ac12Data := (uint(message[5]) << 4) + (uint(message[6])>>4)&0x0FFF
+			m.Altitude = decodeAC12Field(ac12Data)
+		} else {
+			// "HAE" ac2-encoded Altitude
+			// TODO
+		}
+		return m
+
+	case 19:
+		if es.Subtype >= 1 && es.Subtype <= 4 {
+			return decodeVelocity(message, es)
+		}
+
+	case 28:
+		return decodeAircraftStatus(message, es)
+
+	case 29:
+		return decodeTargetState(message, es)
+
+	case 31:
+		return decodeOperationalStatus(message, es)
+	}
+
+	return &es
+}
+
+func decodeCPR(message []byte) CPR {
+	return CPR{
+		RawLat: uint32(message[6])&3<<15 + uint32(message[7])<<7 +
+			uint32(message[8])>>1,
+		RawLon: uint32(message[8])&1<<16 + uint32(message[9])<<8 +
+			uint32(message[10]),
+		Odd: (message[6] & 4) == 4,
+		T:   (message[6] & 8) == 8,
+	}
+}
+
+func decodeVelocity(message []byte, es ExtendedSquitter) *AirborneVelocity {
+	me := meField(message)
+	m := &AirborneVelocity{
+		ExtendedSquitter: es,
+		NACv:             uint8(me.bits(11, 13)),
+		GroundSpeed:      math.MaxInt32,
+		Track:            math.MaxFloat64,
+		MagHeading:       math.MaxFloat64,
+		Airspeed:         math.MaxInt32,
+		VertRate:         math.MaxInt32,
+		VertRateSource:   uint(me.bits(36, 36)),
+		GeomOffset:       math.MaxInt32,
+	}
+
+	// Speeds are in steps of 4 kt for supersonic aircraft
+	scale := int32(1)
+	if es.Subtype == 2 || es.Subtype == 4 {
+		scale = 4
+	}
+
+	// Zero means not available for every field, so values are offset by one
+	if es.Subtype == 1 || es.Subtype == 2 {
+		ew, ns := me.bits(15, 24), me.bits(26, 35)
+		if ew != 0 && ns != 0 {
+			vx := int32(ew-1) * scale
+			if me.bit(14) {
+				vx = -vx // West
+			}
+			vy := int32(ns-1) * scale
+			if me.bit(25) {
+				vy = -vy // South
+			}
+			m.GroundSpeed = int32(math.Round(math.Hypot(float64(vx), float64(vy))))
+			if vx != 0 || vy != 0 {
+				m.Track = math.Mod(math.Atan2(float64(vx), float64(vy))*180/math.Pi+360, 360)
+			}
+		}
+	} else {
+		if me.bit(14) {
+			m.MagHeading = float64(me.bits(15, 24)) * 360 / 1024
+		}
+		m.TrueAirspeed = me.bit(25)
+		if airspeed := me.bits(26, 35); airspeed != 0 {
+			m.Airspeed = int32(airspeed-1) * scale
+		}
+	}
+
+	if rate := me.bits(38, 46); rate != 0 {
+		m.VertRate = int32(rate-1) * 64
+		if me.bit(37) {
+			m.VertRate = -m.VertRate
+		}
+	}
+
+	if offset := me.bits(50, 56); offset != 0 {
+		m.GeomOffset = int32(offset-1) * 25
+		if me.bit(49) {
+			m.GeomOffset = -m.GeomOffset
+		}
+	}
+
+	return m
+}
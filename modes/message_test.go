@@ -0,0 +1,240 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/sbs"
+	"github.com/ccustine/beastie/types"
+)
+
+func TestDecode(t *testing.T) {
+	const addr = 0x4840d6
+	es := func(df uint32, tc, subtype uint8) ExtendedSquitter {
+		return ExtendedSquitter{Header: Header{DF: df, Addr: addr}, TypeCode: tc, Subtype: subtype}
+	}
+	mb := [7]byte{0x20, 0x2c, 0xc3, 0x71, 0xc3, 0x2c, 0xe0}
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    Message
+		wantErr error
+	}{
+		{"identification", convertToBytes("8D4840D6202CC371C32CE0576098"),
+			&Identification{ExtendedSquitter: es(17, 4, 0), Callsign: "KLM1023"}, nil},
+		{"identification, large", convertToBytes("8D4840D6232CC371C32CE0576098"),
+			&Identification{ExtendedSquitter: es(17, 4, 3), Callsign: "KLM1023", Category: 0xa3}, nil},
+		{"identification, surface vehicle", convertToBytes("8D4840D6112CC371C32CE0576098"),
+			&Identification{ExtendedSquitter: es(17, 2, 1), Callsign: "KLM1023", Category: 0xc1}, nil},
+		{"airborne position", convertToBytes("8D40621D58C382D690C8AC2863A7"),
+			&AirbornePosition{ExtendedSquitter: ExtendedSquitter{Header: Header{DF: 17, Addr: 0x40621d}, TypeCode: 11},
+				CPR: CPR{RawLat: 93000, RawLon: 51372}, Altitude: 38000}, nil},
+		{"airborne position, odd", convertToBytes("8D40621D58C386435CC412692AD6"),
+			&AirbornePosition{ExtendedSquitter: ExtendedSquitter{Header: Header{DF: 17, Addr: 0x40621d}, TypeCode: 11},
+				CPR: CPR{RawLat: 74158, RawLon: 50194, Odd: true}, Altitude: 38000}, nil},
+		{"no position", withParity([]byte{0x8d, 0x48, 0x40, 0xd6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 0),
+			&ExtendedSquitter{Header: Header{DF: 17, Addr: addr}}, nil},
+		{"TIS-B control field", withParity([]byte{0x92, 0x48, 0x40, 0xd6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 0),
+			&ExtendedSquitter{Header: Header{DF: 18, Addr: addr}, CF: 2}, nil},
+		{"all-call", withParity([]byte{0x5d, 0x48, 0x40, 0xd6, 0, 0, 0}, 0),
+			&AllCallReply{Header: Header{DF: 11, Addr: addr}, Capability: 5}, nil},
+		{"DF4 altitude", withParity([]byte{0x20, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15, 0, 0, 0}, addr),
+			&AltitudeReply{Header: Header{DF: 4, Addr: addr, AddrParity: true}, Altitude: 35000}, nil},
+		{"DF0 metric altitude", withParity([]byte{0x00, 0, 0x07, 0xe8, 0, 0, 0}, addr),
+			&AltitudeReply{Header: Header{DF: 0, Addr: addr, AddrParity: true}, Altitude: 3281}, nil},
+		{"DF16 Gillham altitude", withParity([]byte{0x80, 0, byte(ac13(gillham(20)) >> 8), byte(ac13(gillham(20))), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, addr),
+			&AltitudeReply{Header: Header{DF: 16, Addr: addr, AddrParity: true}, Altitude: 2000}, nil},
+		{"DF4 altitude not available", withParity([]byte{0x20, 0, 0, 0, 0, 0, 0}, addr),
+			&AltitudeReply{Header: Header{DF: 4, Addr: addr, AddrParity: true}, Altitude: math.MaxInt32}, nil},
+		{"DF5 squawk", withParity([]byte{0x28, 0, 0x0a, 0xaa, 0, 0, 0}, addr),
+			&IdentityReply{Header: Header{DF: 5, Addr: addr, AddrParity: true}, Squawk: 0x7700}, nil},
+		{"DF20 Comm-B", withParity(append([]byte{0xa0, 0, 1440 >> 6, 0x80 | 0x10 | 1440&15}, append(mb[:], 0, 0, 0)...), addr),
+			&CommBAltitudeReply{AltitudeReply: AltitudeReply{Header: Header{DF: 20, Addr: addr, AddrParity: true}, Altitude: 35000}, MB: mb}, nil},
+		{"DF21 Comm-B", withParity(append([]byte{0xa8, 0, 0x0a, 0xaa}, append(mb[:], 0, 0, 0)...), addr),
+			&CommBIdentityReply{IdentityReply: IdentityReply{Header: Header{DF: 21, Addr: addr, AddrParity: true}, Squawk: 0x7700}, MB: mb}, nil},
+		{"empty", nil, nil, ErrLength},
+		{"short extended squitter", convertToBytes("8D4840D6202CC3"), nil, ErrLength},
+		{"long surveillance", withParity([]byte{0x20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, addr), nil, ErrLength},
+		{"DF24", convertToBytes("C04840D6202CC371C32CE0576098"), nil, ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.message)
+			if err != tt.wantErr {
+				t.Fatalf("Decode(%x) error = %v, want %v", tt.message, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode(%x) = \ngot:  %#v\nwant: %#v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_Velocity(t *testing.T) {
+	es := func(addr uint32, subtype uint8) ExtendedSquitter {
+		return ExtendedSquitter{Header: Header{DF: 17, Addr: addr}, TypeCode: 19, Subtype: subtype}
+	}
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    AirborneVelocity
+	}{
+		{"ground speed", convertToBytes("8D485020994409940838175B284F"), AirborneVelocity{
+			ExtendedSquitter: es(0x485020, 1), GroundSpeed: 159, Track: 182.88, MagHeading: math.MaxFloat64,
+			Airspeed: math.MaxInt32, VertRate: -832, VertRateSource: VertRateGNSS, GeomOffset: 550}},
+		{"airspeed", convertToBytes("8DA05F219B06B6AF189400CBC33F"), AirborneVelocity{
+			ExtendedSquitter: es(0xa05f21, 3), GroundSpeed: math.MaxInt32, Track: math.MaxFloat64, MagHeading: 243.98,
+			Airspeed: 375, TrueAirspeed: true, VertRate: -2304, VertRateSource: VertRateBaro, GeomOffset: math.MaxInt32}},
+		{"supersonic ground speed", squitter(19<<51 | 2<<48 | 1<<43 | 1<<42 | 101<<32 | 1<<31 | 51<<21 | 1<<20 | 1<<19 | 3<<10 | 1<<7 | 5),
+			AirborneVelocity{ExtendedSquitter: es(0x4840d6, 2), NACv: 1, GroundSpeed: 447, Track: 243.43,
+				MagHeading: math.MaxFloat64, Airspeed: math.MaxInt32, VertRate: -128, VertRateSource: VertRateBaro, GeomOffset: -100}},
+		{"supersonic airspeed", squitter(19<<51 | 4<<48 | 1<<42 | 256<<32 | 501<<21 | 1<<10),
+			AirborneVelocity{ExtendedSquitter: es(0x4840d6, 4), GroundSpeed: math.MaxInt32, Track: math.MaxFloat64, MagHeading: 90,
+				Airspeed: 2000, VertRate: 0, GeomOffset: math.MaxInt32}},
+		{"not available", squitter(19<<51 | 1<<48),
+			AirborneVelocity{ExtendedSquitter: es(0x4840d6, 1), GroundSpeed: math.MaxInt32, Track: math.MaxFloat64,
+				MagHeading: math.MaxFloat64, Airspeed: math.MaxInt32, VertRate: math.MaxInt32, GeomOffset: math.MaxInt32}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			velocity, ok := got.(*AirborneVelocity)
+			if !ok {
+				t.Fatalf("Decode() = %T, want *AirborneVelocity", got)
+			}
+			// Angles to two decimals
+			v := *velocity
+			for _, angle := range []*float64{&v.Track, &v.MagHeading} {
+				if *angle != math.MaxFloat64 {
+					*angle = math.Round(*angle*100) / 100
+				}
+			}
+			if v != tt.want {
+				t.Errorf("Decode() = %+v, want %+v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_Update(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+	receivers := []types.Reception{{Receiver: "local", Rssi: -20}}
+
+	// The tracker keeps the state of the aircraft between messages itself
+	track := func(msg Message, isMlat bool) types.AircraftData {
+		aircraft := tracker.Update(msg, isMlat, receivers)
+		if stored, ok := tracker.aircraft.Load(aircraft.IcaoAddr); aircraft.IsValid && (!ok || !reflect.DeepEqual(*stored, aircraft)) {
+			t.Errorf("Update() stored %+v, returned %+v", stored, aircraft)
+		}
+		return aircraft
+	}
+
+	// Messages from elsewhere than Decode are tracked the same way
+	header := ExtendedSquitter{Header: Header{DF: 17, Addr: 0x40621d}, TypeCode: 4}
+	got := track(&Identification{ExtendedSquitter: header, Callsign: "KLM1023", Category: 0xa3}, false)
+	if !got.IsValid || got.Callsign != "KLM1023" || got.Category != 0xa3 || got.LastES.IsZero() {
+		t.Fatalf("Update() = %#v, want a valid aircraft with the callsign and category", got)
+	}
+
+	for _, message := range []string{"8D40621D58C382D690C8AC2863A7", "8D40621D58C386435CC412692AD6"} {
+		msg, err := Decode(convertToBytes(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = track(msg, true)
+	}
+	if got.Altitude != 38000 || got.Callsign != "KLM1023" {
+		t.Errorf("Update() = %d ft as %q, want 38000 ft as KLM1023", got.Altitude, got.Callsign)
+	}
+	if math.Abs(got.Latitude-52.2658) > 0.001 || math.Abs(got.Longitude-3.9389) > 0.001 {
+		t.Errorf("Update() position = %.4f, %.4f, want the odd one at 52.2658, 3.9389", got.Latitude, got.Longitude)
+	}
+	if !got.Mlat || got.PositionSource != "local" {
+		t.Errorf("Update() position from %q mlat %t, want from local by mlat", got.PositionSource, got.Mlat)
+	}
+
+	// Replies are only attributed to aircraft recently heard in the clear
+	reply := &AltitudeReply{Header: Header{DF: 4, Addr: 0x40621d, AddrParity: true}, Altitude: 39000}
+	if got := track(reply, false); !got.IsValid || got.Altitude != 39000 {
+		t.Errorf("Update() of a reply = %d ft valid %t, want 39000 ft", got.Altitude, got.IsValid)
+	}
+	commB := &CommBAltitudeReply{AltitudeReply: *reply, MB: mb("A000029C85E42F313000007047D3")}
+	if got := track(commB, false); got.CommB.BDS != BDS40 || got.CommB.SelAltitude != 3008 || got.CommB.BaroSetting != 1020 {
+		t.Errorf("Update() of a Comm-B reply = %+v, want BDS 4,0 at 3008 ft", got.CommB)
+	}
+	stale := got
+	stale.LastES = time.Now().Add(-2 * apAddressTimeout)
+	tracker.aircraft.Store(stale.IcaoAddr, &stale)
+	if got := track(reply, false); got.IsValid {
+		t.Error("Update() attributed a reply to an aircraft not heard in an extended squitter lately")
+	}
+}
+
+func TestTracker_UpdateSbs(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+	tracker.Decode(convertToBytes("8D4840D6202CC371C32CE0576098"), false, []types.Reception{{Receiver: "local", Rssi: -20}})
+
+	// BaseStation messages update the aircraft the frames do
+	msg, err := sbs.Parse("MSG,3,111,11111,4840D6,111111,2018/11/05,21:09:27.284,2018/11/05,21:09:27.284,,35000,,,52.25,3.91,,,0,0,0,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tracker.UpdateSbs(msg, "sbs:30003")
+	if got.Callsign != "KLM1023" || got.Altitude != 35000 || got.Latitude != 52.25 || got.PositionSource != "sbs:30003" {
+		t.Errorf("UpdateSbs() = %q at %d ft from %q, want KLM1023 at 35000 ft from sbs:30003",
+			got.Callsign, got.Altitude, got.PositionSource)
+	}
+	if len(got.Receivers) != 2 {
+		t.Errorf("UpdateSbs() receivers = %+v, want local and sbs:30003", got.Receivers)
+	}
+	if stored, ok := tracker.aircraft.Load(0x4840d6); !ok || !reflect.DeepEqual(*stored, got) {
+		t.Errorf("UpdateSbs() stored %+v, returned %+v", stored, got)
+	}
+}
+
+func TestTracker_Update_Velocity(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+	tracker.Decode(convertToBytes("8D485020994409940838175B284F"), false, nil)
+
+	// Airspeed squitters keep the ground speed and track
+	velocity := &AirborneVelocity{ExtendedSquitter: ExtendedSquitter{Header: Header{DF: 17, Addr: 0x485020}, TypeCode: 19, Subtype: 3},
+		GroundSpeed: math.MaxInt32, Track: math.MaxFloat64, MagHeading: 180.5, Airspeed: 250,
+		VertRate: 1024, VertRateSource: VertRateBaro, GeomOffset: math.MaxInt32}
+	got := tracker.Update(velocity, false, nil)
+
+	if got.Speed != 159 || got.Heading != 183 || math.Abs(got.Track-182.88) > 0.01 || !got.HeadingIsValid {
+		t.Errorf("Update() = %d kt on %d (%.2f), want 159 kt on 183", got.Speed, got.Heading, got.Track)
+	}
+	if got.MagHeading != 180.5 || got.IAS != 250 || got.TAS != 0 || got.GeomOffset != 550 {
+		t.Errorf("Update() heading %.1f IAS %d TAS %d offset %d, want 180.5, 250 kt IAS and 550 ft",
+			got.MagHeading, got.IAS, got.TAS, got.GeomOffset)
+	}
+	if got.GeomRate != -832 || got.BaroRate != 1024 {
+		t.Errorf("Update() rates %d GNSS and %d baro, want -832 and 1024", got.GeomRate, got.BaroRate)
+	}
+	if got.VertRate != 1024 || got.VertRateSign != 0 || got.VertRateSource != VertRateBaro {
+		t.Errorf("Update() vertical rate %d sign %d source %d, want the latest", got.VertRate, got.VertRateSign, got.VertRateSource)
+	}
+}
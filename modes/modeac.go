@@ -0,0 +1,191 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccustine/beastie/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Mode A/C replies carry 12 code bits laid out like a squawk, one octal digit
+// A, B, C and D per nibble, with the SPI pulse at 0x0080
+const (
+	modeACCodeMask = 0x7777
+	modeACSpi      = 0x0080
+
+	// Mode C is in 100 ft steps, Mode S usually in 25 ft steps
+	modeCMatchFeet = 100
+)
+
+// DecodeModeAC attributes a Mode A/C reply to the Mode S aircraft with the
+// same squawk or altitude, and stores it. Replies that match no Mode S
+// aircraft are tracked as Mode A/C only targets, one per code, as a reply
+// alone does not tell whether the code is an identity or an altitude.
+func (t *Tracker) DecodeModeAC(message []byte, isMlat bool, receivers []types.Reception) types.AircraftData {
+	if len(message) != 2 {
+		return types.AircraftData{IsValid: false}
+	}
+
+	raw := uint32(message[0])<<8 | uint32(message[1])
+	code := raw & modeACCodeMask
+	altitude := int32(math.MaxInt32)
+	if modeC, ok := ModeAToModeC(uint(code)); ok {
+		altitude = modeC * 100
+	}
+	now := time.Now()
+
+	if match := t.correlateModeAC(code, altitude); match != nil {
+		aircraft := *match
+		if aircraft.Squawk == code {
+			aircraft.ModeAMatch = now
+		} else {
+			aircraft.ModeCMatch = now
+		}
+		t.aircraft.Store(aircraft.IcaoAddr, &aircraft)
+		return aircraft
+	}
+
+	sig := 0.0
+	if len(receivers) > 0 {
+		sig = receivers[0].Rssi
+	}
+
+	addr := types.ModeACAddr(code)
+	var aircraft types.AircraftData
+	if ptrAircraft, ok := t.aircraft.Load(addr); ok {
+		aircraft = *ptrAircraft
+	} else {
+		if t.debug {
+			log.Debugf("New Mode A/C target %04x", code)
+		}
+		aircraft = types.AircraftData{
+			IcaoAddr:     addr,
+			Squawk:       code,
+			ORawLat:      math.MaxUint32,
+			ORawLon:      math.MaxUint32,
+			ERawLat:      math.MaxUint32,
+			ERawLon:      math.MaxUint32,
+			Latitude:     math.MaxFloat64,
+			Longitude:    math.MaxFloat64,
+			Altitude:     altitude,
+			VertRateSign: math.MaxUint32,
+			ModeAC:       true,
+			IsValid:      true,
+		}
+	}
+	aircraft.Rssi = sig
+	aircraft.Spi = raw&modeACSpi != 0
+	aircraft.LastPing = now
+	aircraft.Heard(receivers, aircraft.LastPing)
+
+	stored := aircraft
+	t.aircraft.Store(addr, &stored)
+	return aircraft
+}
+
+// correlateModeAC returns the most recently heard Mode S aircraft squawking
+// code, or else flying at altitude
+func (t *Tracker) correlateModeAC(code uint32, altitude int32) *types.AircraftData {
+	var squawkMatch, altMatch *types.AircraftData
+	t.aircraft.Range(func(aircraft *types.AircraftData) bool {
+		if aircraft.ModeAC {
+			return true
+		}
+
+		if code != 0 && aircraft.Squawk == code {
+			if squawkMatch == nil || aircraft.LastPing.After(squawkMatch.LastPing) {
+				squawkMatch = aircraft
+			}
+		} else if altitude != math.MaxInt32 && aircraft.Altitude != math.MaxInt32 && !aircraft.Surface {
+			diff := aircraft.Altitude - altitude
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff < modeCMatchFeet && (altMatch == nil || aircraft.LastPing.After(altMatch.LastPing)) {
+				altMatch = aircraft
+			}
+		}
+		return true
+	})
+
+	if squawkMatch != nil {
+		return squawkMatch
+	}
+	return altMatch
+}
+
+// ModeAToModeC converts a Gillham coded altitude, laid out like a squawk, to
+// hundreds of feet. It returns false for codes that are not valid altitudes.
+func ModeAToModeC(code uint) (int32, bool) {
+	// D1 is never used for altitude and C1, C2, C4 cannot all be zero
+	if code&^0x7776 != 0 || code&0x0070 == 0 {
+		return 0, false
+	}
+
+	// 100 ft steps are a Gray code of 1 to 5 in C1, C2, C4, with 7 sent as 5
+	var oneHundreds uint
+	if code&0x0010 != 0 {
+		oneHundreds ^= 0x007
+	} // C1
+	if code&0x0020 != 0 {
+		oneHundreds ^= 0x003
+	} // C2
+	if code&0x0040 != 0 {
+		oneHundreds ^= 0x001
+	} // C4
+	if oneHundreds&5 == 5 {
+		oneHundreds ^= 2
+	}
+	if oneHundreds > 5 {
+		return 0, false
+	}
+
+	// 500 ft steps are a Gray code in D2, D4, A1, A2, A4, B1, B2, B4
+	var fiveHundreds uint
+	if code&0x0002 != 0 {
+		fiveHundreds ^= 0x0ff
+	} // D2
+	if code&0x0004 != 0 {
+		fiveHundreds ^= 0x07f
+	} // D4
+	if code&0x1000 != 0 {
+		fiveHundreds ^= 0x03f
+	} // A1
+	if code&0x2000 != 0 {
+		fiveHundreds ^= 0x01f
+	} // A2
+	if code&0x4000 != 0 {
+		fiveHundreds ^= 0x00f
+	} // A4
+	if code&0x0100 != 0 {
+		fiveHundreds ^= 0x007
+	} // B1
+	if code&0x0200 != 0 {
+		fiveHundreds ^= 0x003
+	} // B2
+	if code&0x0400 != 0 {
+		fiveHundreds ^= 0x001
+	} // B4
+
+	// The 100 ft steps count down in odd 500 ft steps
+	if fiveHundreds&1 != 0 {
+		oneHundreds = 6 - oneHundreds
+	}
+
+	return int32(fiveHundreds*5+oneHundreds) - 13, true
+}
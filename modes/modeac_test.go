@@ -0,0 +1,140 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/types"
+)
+
+// gillham encodes an altitude in hundreds of feet the way an encoding
+// altimeter does, laid out like a squawk
+func gillham(hundreds int) uint {
+	fiveHundreds := uint(hundreds+12) / 5
+	oneHundreds := uint(hundreds+12)%5 + 1
+	if fiveHundreds&1 != 0 {
+		oneHundreds = 6 - oneHundreds
+	}
+
+	gray := fiveHundreds ^ fiveHundreds>>1
+	c := oneHundreds ^ oneHundreds>>1
+	if c == 7 {
+		c = 4
+	}
+
+	var code uint
+	// D2 D4 A1 A2 A4 B1 B2 B4 from the most significant bit
+	for i, bit := range []uint{0x0002, 0x0004, 0x1000, 0x2000, 0x4000, 0x0100, 0x0200, 0x0400} {
+		if gray&(0x80>>uint(i)) != 0 {
+			code |= bit
+		}
+	}
+	// C1 C2 C4
+	for i, bit := range []uint{0x0010, 0x0020, 0x0040} {
+		if c&(4>>uint(i)) != 0 {
+			code |= bit
+		}
+	}
+	return code
+}
+
+func TestModeAToModeC(t *testing.T) {
+	for hundreds := -12; hundreds <= 1267; hundreds++ {
+		code := gillham(hundreds)
+		if got, ok := ModeAToModeC(code); !ok || got != int32(hundreds) {
+			t.Errorf("ModeAToModeC(%04x) = %d, %t, want %d", code, got, ok, hundreds)
+		}
+	}
+
+	tests := []struct {
+		name string
+		code uint
+	}{
+		{"no C pulses", 0x1200},
+		{"D1 set", 0x0011},
+		{"invalid 100 ft step", 0x0050},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := ModeAToModeC(tt.code); ok {
+				t.Errorf("ModeAToModeC(%04x) = %d, want invalid", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestTracker_DecodeModeAC(t *testing.T) {
+	knownAircraft := types.NewAircraftMap()
+	knownAircraft.Store(0xa6c6c8, &types.AircraftData{IcaoAddr: 0xa6c6c8, Squawk: 0x1200, Altitude: 35000, IsValid: true})
+	knownAircraft.Store(0x4840d6, &types.AircraftData{IcaoAddr: 0x4840d6, Squawk: 0x7700, Altitude: 3975, IsValid: true})
+	tracker := NewTracker(knownAircraft, &config.BeastInfo{})
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		message   []byte
+		wantAddr  uint32
+		wantModeA bool
+		wantModeC bool
+		wantAlt   int32
+		wantSpi   bool
+	}{
+		{"squawk match", []byte{0x12, 0x00}, 0xa6c6c8, true, false, 35000, false},
+		{"altitude match", codeBytes(gillham(40)), 0x4840d6, false, true, 3975, false},
+		{"mode A/C only", []byte{0x34, 0x01}, types.ModeACAddr(0x3401), false, false, math.MaxInt32, false},
+		{"mode A/C only with altitude and SPI", codeBytes(gillham(100) | modeACSpi), types.ModeACAddr(uint32(gillham(100))), false, false, 10000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tracker.DecodeModeAC(tt.message, false, []types.Reception{{Receiver: "rtl", Rssi: -10}})
+			if !got.IsValid || got.IcaoAddr != tt.wantAddr || got.ModeAMatched(now) != tt.wantModeA ||
+				got.ModeCMatched(now) != tt.wantModeC || got.Altitude != tt.wantAlt || got.Spi != tt.wantSpi {
+				t.Errorf("DecodeModeAC(%x) = %+v", tt.message, got)
+			}
+			if got.ModeAC != (tt.wantAddr > 0xffffff) {
+				t.Errorf("DecodeModeAC(%x) ModeAC = %t", tt.message, got.ModeAC)
+			}
+			if stored, ok := knownAircraft.Load(tt.wantAddr); !ok || !reflect.DeepEqual(*stored, got) {
+				t.Errorf("DecodeModeAC(%x) stored %+v", tt.message, stored)
+			}
+		})
+	}
+
+	// Matches do not last
+	if got, _ := knownAircraft.Load(0xa6c6c8); got.ModeAMatched(now.Add(2 * types.ModeACMatchTimeout)) {
+		t.Errorf("ModeAMatched() = true long after the reply")
+	}
+
+	// Mode A/C only targets never correlate with each other
+	target := tracker.DecodeModeAC([]byte{0x34, 0x01}, false, nil)
+	target.Altitude = 3400
+	knownAircraft.Store(target.IcaoAddr, &target)
+	if got := tracker.DecodeModeAC(codeBytes(gillham(34)), false, nil); !got.ModeAC {
+		t.Errorf("DecodeModeAC() correlated with a Mode A/C target: %+v", got)
+	}
+
+	if got := tracker.DecodeModeAC([]byte{0x12}, false, nil); got.IsValid {
+		t.Errorf("DecodeModeAC() accepted a short reply: %+v", got)
+	}
+}
+
+func codeBytes(code uint) []byte {
+	return []byte{byte(code >> 8), byte(code)}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+
+	"github.com/ccustine/beastie/types"
+)
+
+// AircraftStatus is an extended squitter with the emergency or priority state
+// and the squawk (TC28 subtype 1). Emergency is 0 for none, then general,
+// lifeguard, minimum fuel, no communications, unlawful interference and downed
+// aircraft.
+type AircraftStatus struct {
+	ExtendedSquitter
+	Emergency uint8
+	Squawk    uint32
+}
+
+// RABroadcast is an extended squitter with the resolution advisory ACAS is
+// giving (TC28 subtype 2)
+type RABroadcast struct {
+	ExtendedSquitter
+	ACASResolution
+}
+
+// TargetState is an extended squitter with the autopilot state of ADS-B
+// version 2 (TC29 subtype 1). Version 1 target states are not decoded.
+type TargetState struct {
+	ExtendedSquitter
+	types.TargetState
+}
+
+// OperationalStatus is an extended squitter with the ADS-B version and the
+// capabilities of the equipment (TC31, subtype 0 airborne and 1 surface)
+type OperationalStatus struct {
+	ExtendedSquitter
+	types.OperationalStatus
+}
+
+// meField returns the ME field of an extended squitter
+func meField(message []byte) mbField {
+	var me [7]byte
+	copy(me[:], message[4:11])
+	return newMBField(me)
+}
+
+func decodeAircraftStatus(message []byte, es ExtendedSquitter) Message {
+	me := meField(message)
+	switch es.Subtype {
+	case 1:
+		return &AircraftStatus{
+			ExtendedSquitter: es,
+			Emergency:        uint8(me.bits(9, 11)),
+			Squawk:           uint32(decodeID13Field(uint(me.bits(12, 24)))),
+		}
+	case 2:
+		return &RABroadcast{ExtendedSquitter: es, ACASResolution: decodeRA(me)}
+	}
+	return &es
+}
+
+func decodeTargetState(message []byte, es ExtendedSquitter) Message {
+	if es.Subtype != 1 {
+		return &es
+	}
+
+	me := meField(message)
+	m := &TargetState{ExtendedSquitter: es, TargetState: types.TargetState{
+		SelAltitude: math.MaxInt32,
+		FMSAltitude: me.bit(9),
+		BaroSetting: math.MaxFloat64,
+		SelHeading:  math.MaxFloat64,
+		NACp:        uint8(me.bits(40, 43)),
+		NICBaro:     me.bit(44),
+		SIL:         uint8(me.bits(45, 46)),
+		ModesValid:  me.bit(47),
+		TCAS:        me.bit(53),
+	}}
+
+	// Zero means no data for the altitude and the baro setting
+	if alt := me.bits(10, 20); alt != 0 {
+		m.SelAltitude = int32(alt-1) * 32
+	}
+	if baro := me.bits(21, 29); baro != 0 {
+		m.BaroSetting = 800 + float64(baro-1)*0.8
+	}
+	if me.bit(30) {
+		m.SelHeading = float64(me.bits(31, 39)) * 180 / 256
+	}
+	if m.ModesValid {
+		m.Autopilot = me.bit(48)
+		m.VNAV = me.bit(49)
+		m.AltitudeHold = me.bit(50)
+		m.Approach = me.bit(52)
+		m.LNAV = me.bit(54)
+	}
+	return m
+}
+
+func decodeOperationalStatus(message []byte, es ExtendedSquitter) Message {
+	if es.Subtype > 1 {
+		return &es
+	}
+
+	me := meField(message)
+	m := &OperationalStatus{ExtendedSquitter: es}
+	m.Version = uint8(me.bits(41, 43))
+	// Version 0 has a different layout, of which only the version is used
+	if m.Version == 0 || m.Version > 2 {
+		return m
+	}
+
+	airborne := es.Subtype == 0
+	if me.bits(25, 26) == 0 {
+		m.RAActive = me.bit(27)
+		m.IdentActive = me.bit(28)
+		m.ATCServices = me.bit(29)
+		if m.Version == 2 {
+			m.SingleAntenna = me.bit(30)
+			m.SDA = uint8(me.bits(31, 32))
+		}
+	}
+
+	// Capability classes with other codes in the reserved bits are of later
+	// versions
+	if me.bits(9, 10) == 0 && me.bits(13, 14) == 0 {
+		switch {
+		case airborne && m.Version == 1:
+			m.ACAS = !me.bit(11) // Set when ACAS is not operational
+			m.CDTI = me.bit(12)
+		case airborne:
+			m.ACAS = me.bit(11)
+			m.ES1090In = me.bit(12)
+			m.UATIn = me.bit(19)
+		case m.Version == 1:
+			m.POA = me.bit(11)
+			m.CDTI = me.bit(12)
+			m.B2Low = me.bit(15)
+		default:
+			m.POA = me.bit(11)
+			m.ES1090In = me.bit(12)
+			m.B2Low = me.bit(15)
+			m.UATIn = me.bit(16)
+			m.NACv = uint8(me.bits(17, 19))
+			m.NICSupplementC = me.bit(20)
+		}
+		if airborne {
+			m.ARV = me.bit(15)
+			m.TS = me.bit(16)
+			m.TC = uint8(me.bits(17, 18))
+		} else {
+			m.LengthWidth = uint8(me.bits(21, 24))
+		}
+	}
+
+	m.NICSupplementA = me.bit(44)
+	m.NACp = uint8(me.bits(45, 48))
+	m.SIL = uint8(me.bits(51, 52))
+	if airborne {
+		m.NICBaro = me.bit(53)
+	} else {
+		m.TrackAngle = me.bit(53)
+	}
+	m.HRD = me.bit(54)
+	if m.Version == 2 {
+		if airborne {
+			m.GVA = uint8(me.bits(49, 50))
+		}
+		m.SILPerSample = me.bit(55)
+	}
+	return m
+}
@@ -0,0 +1,140 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/types"
+)
+
+// squitter returns a DF17 message from 4840d6 with the given ME field. The
+// parity is left zero as Decode does not check it.
+func squitter(me uint64) []byte {
+	message := []byte{0x8d, 0x48, 0x40, 0xd6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	for i := 0; i < 7; i++ {
+		message[4+i] = byte(me >> uint(48-8*i))
+	}
+	return message
+}
+
+func TestDecode_Status(t *testing.T) {
+	es := func(addr uint32, tc, subtype uint8) ExtendedSquitter {
+		return ExtendedSquitter{Header: Header{DF: 17, Addr: addr}, TypeCode: tc, Subtype: subtype}
+	}
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    Message
+	}{
+		{"emergency", squitter(28<<51 | 1<<48 | 1<<45 | uint64(ac13(0x7700))<<32),
+			&AircraftStatus{ExtendedSquitter: es(0x4840d6, 28, 1), Emergency: 1, Squawk: 0x7700}},
+		{"resolution advisory", squitter(28<<51 | 2<<48 | 0x2080<<34),
+			&RABroadcast{ExtendedSquitter: es(0x4840d6, 28, 2), ACASResolution: ACASResolution{ARA: 0x2080}}},
+		{"target state", convertToBytes("8DA05629EA21485CBF3F8CADAEEB"),
+			&TargetState{ExtendedSquitter: es(0xa05629, 29, 1), TargetState: types.TargetState{
+				SelAltitude: 16992, BaroSetting: 1012.8, SelHeading: 66.796875, NACp: 9, NICBaro: true, SIL: 3,
+				ModesValid: true, Autopilot: true, VNAV: true, LNAV: true, TCAS: true}}},
+		{"target state version 1", squitter(29<<51 | 0x5a<<40),
+			&ExtendedSquitter{Header: Header{DF: 17, Addr: 0x4840d6}, TypeCode: 29}},
+		{"operational status", convertToBytes("8DA05629F8210002004AB8F7D8A5"),
+			&OperationalStatus{ExtendedSquitter: es(0xa05629, 31, 0), OperationalStatus: types.OperationalStatus{
+				Version: 2, NACp: 10, GVA: 2, SIL: 3, NICBaro: true, ACAS: true, TS: true, SDA: 2}}},
+		{"operational status surface", squitter(31<<51 | 1<<48 | 2<<37 | 1<<36 | 5<<32 | 2<<13 | 1<<12 | 9<<8 | 1<<3),
+			&OperationalStatus{ExtendedSquitter: es(0x4840d6, 31, 1), OperationalStatus: types.OperationalStatus{
+				Version: 2, NICSupplementA: true, NACp: 9, TrackAngle: true, NACv: 2, NICSupplementC: true, LengthWidth: 5}}},
+		{"operational status version 0", squitter(31<<51 | 0x3f<<40),
+			&OperationalStatus{ExtendedSquitter: es(0x4840d6, 31, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositionIntegrity(t *testing.T) {
+	tests := []struct {
+		name    string
+		tc      uint8
+		version uint8
+		a, b, c bool
+		want    integrity
+	}{
+		{"NUCp", 11, 0, true, true, false, integrity{7, 0.1 * nm}},
+		{"NUCp surface", 7, 0, false, false, false, integrity{6, 0.1 * nm}},
+		{"NIC 11", 9, 2, false, false, false, integrity{11, 7.5}},
+		{"NIC 9", 11, 2, true, true, false, integrity{9, 75}},
+		{"NIC 8", 11, 2, true, false, false, integrity{8, 0.1 * nm}},
+		{"NIC 9 version 1", 11, 1, true, false, false, integrity{9, 75}},
+		{"NIC 6 0.3 NM", 13, 2, false, true, false, integrity{6, 0.3 * nm}},
+		{"NIC 6 0.6 NM version 1", 13, 1, true, false, false, integrity{6, 0.6 * nm}},
+		{"NIC 3", 16, 2, true, true, false, integrity{3, 4 * nm}},
+		{"NIC 0", 18, 2, true, true, true, integrity{0, 0}},
+		{"surface NIC 9", 7, 2, true, false, false, integrity{9, 75}},
+		{"surface NIC 7", 8, 2, true, false, true, integrity{7, 0.2 * nm}},
+		{"surface NIC 0 version 1", 8, 1, true, false, false, integrity{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := positionIntegrity(tt.tc, tt.version, tt.a, tt.b, tt.c); got != tt.want {
+				t.Errorf("positionIntegrity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_Update_Status(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{})
+	track := func(message []byte) types.AircraftData {
+		return tracker.Decode(message, false, nil)
+	}
+
+	// NUCp until the version is known
+	position := squitter(11<<51 | 1<<48)
+	if got := track(position); got.NIC != 7 || got.Rc != 0.1*nm {
+		t.Errorf("Update() NIC = %d, %.1f m, want NUCp 7", got.NIC, got.Rc)
+	}
+	track(squitter(31<<51 | 2<<13 | 1<<12))
+	if got := track(position); got.OpStatus == nil || got.NIC != 9 || got.Rc != 75 {
+		t.Errorf("Update() NIC = %d, %.1f m, want 9 for version 2", got.NIC, got.Rc)
+	}
+
+	got := track(squitter(28<<51 | 1<<48 | 1<<45 | uint64(ac13(0x7700))<<32))
+	if !got.Emergency || got.EmergencyState != 1 || got.Squawk != 0x7700 {
+		t.Errorf("Update() emergency %t state %d squawk %04x, want general 7700", got.Emergency, got.EmergencyState, got.Squawk)
+	}
+	if got = track(squitter(28<<51 | 2<<48 | 0x2080<<34)); got.ACASRA != "climb" {
+		t.Errorf("Update() RA = %q, want climb", got.ACASRA)
+	}
+	if got = track(squitter(28<<51 | 2<<48 | 0x2080<<34 | 1<<29)); got.ACASRA != "" {
+		t.Errorf("Update() RA = %q after it terminated", got.ACASRA)
+	}
+
+	got = track(convertToBytes("8DA05629EA21485CBF3F8CADAEEB"))
+	if got.TargetState == nil || got.TargetState.SelAltitude != 16992 || math.Abs(got.TargetState.BaroSetting-1012.8) > 0.01 {
+		t.Errorf("Update() target state = %+v, want 16992 ft on 1012.8 mb", got.TargetState)
+	}
+}
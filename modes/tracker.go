@@ -0,0 +1,476 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/db"
+	"github.com/ccustine/beastie/sbs"
+	"github.com/ccustine/beastie/types"
+	"github.com/kellydunn/golang-geo"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+var formatNames = map[uint32]string{
+	0:  "short air-air surveillance (TCAS)",
+	4:  "surveillance, Altitude reply",
+	5:  "surveillance, Mode A identity reply",
+	11: "All-Call reply containing aircraft address",
+	16: "long air-air surveillance (TCAS)",
+	17: "extended squitter",
+	18: "TIS-B",
+	19: "military extended squitter",
+	20: "Comm-B including Altitude reply",
+	21: "Comm-B reply including Mode A identity",
+	22: "military use",
+	24: "special long msg",
+}
+
+// cprLocalMaxAge is how recent a position must be to decode a single position
+// relative to it
+const cprLocalMaxAge = 60 * time.Second
+
+// cprLocalMaxRange is the range in NM within which airborne positions are
+// decoded relative to the receiver, half an airborne zone
+const cprLocalMaxRange = 180
+
+// Tracker applies decoded messages to the state of the aircraft that sent
+// them
+type Tracker struct {
+	aircraft *types.AircraftMap
+	home     *geo.Point // Receiver location for the range, none when nil
+	debug    bool
+
+	maxRange     float64                  // NM, 0 for no limit
+	ranges       map[string]receiverRange // Receivers placed or limited on their own
+	minPositions int
+}
+
+func NewTracker(knownAircraft *types.AircraftMap, info *config.BeastInfo) *Tracker {
+	t := &Tracker{aircraft: knownAircraft, home: info.Homepos, debug: info.Debug,
+		maxRange: info.MaxRange, ranges: map[string]receiverRange{}, minPositions: info.MinPositions}
+	for _, source := range info.Sources {
+		if source.MaxRange > 0 || source.Latitude != 0 || source.Longitude != 0 {
+			t.ranges[source.Name()] = t.newReceiverRange(source.Latitude, source.Longitude, source.MaxRange)
+		}
+	}
+	for _, receiver := range info.Receivers {
+		t.ranges[receiver.Name] = t.newReceiverRange(receiver.Latitude, receiver.Longitude, receiver.MaxRange)
+	}
+	return t
+}
+
+// squitter returns the fields common to every extended squitter, which is how
+// the tracker tells them from replies
+func (es *ExtendedSquitter) squitter() *ExtendedSquitter {
+	return es
+}
+
+// Decode decodes message and applies it to the aircraft that sent it.
+// receivers lists every receiver that heard it, the one whose copy is decoded
+// first.
+func (t *Tracker) Decode(message []byte, isMlat bool, receivers []types.Reception) types.AircraftData {
+	if len(message) > 0 {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("DF %02d", getbits(message, 1, 5)), nil).Inc(1)
+	}
+
+	msg, err := Decode(message)
+	if err != nil {
+		if t.debug {
+			log.Debugf("Unable to decode %x: %s", message, err)
+		}
+		return types.AircraftData{IsValid: false}
+	}
+	return t.Update(msg, isMlat, receivers)
+}
+
+// Update applies msg to the aircraft that sent it, stores the aircraft and
+// returns a copy of it, which is not valid when msg can not be attributed to
+// one
+func (t *Tracker) Update(msg Message, isMlat bool, receivers []types.Reception) types.AircraftData {
+	icaoAddr := msg.Address()
+
+	if msg.ParityAddress() {
+		if !t.recentES(icaoAddr) {
+			APRejected.Inc(1)
+			if t.debug {
+				log.WithFields(log.Fields{
+					"icao":    fmt.Sprintf("%06x", icaoAddr),
+					"df":      msg.Format(),
+					"msgtype": formatNames[msg.Format()],
+				}).Debugf("No recent extended squitter from address %06x", icaoAddr)
+			}
+			return types.AircraftData{IsValid: false}
+		}
+		APRecovered.Inc(1)
+	}
+
+	sig := 0.0
+	if len(receivers) > 0 {
+		sig = receivers[0].Rssi
+	}
+
+	var aircraft types.AircraftData
+	if ptrAircraft, ok := t.aircraft.Load(icaoAddr); ok {
+		aircraft = *ptrAircraft
+	} else {
+		// Initial values
+		aircraft = types.AircraftData{
+			IcaoAddr:     icaoAddr,
+			ORawLat:      math.MaxUint32,
+			ORawLon:      math.MaxUint32,
+			ERawLat:      math.MaxUint32,
+			ERawLon:      math.MaxUint32,
+			Latitude:     math.MaxFloat64,
+			Longitude:    math.MaxFloat64,
+			Altitude:     math.MaxInt32,
+			VertRateSign: math.MaxUint32,
+			IsValid:      true,
+			Country:      db.IcaoToCountry(icaoAddr),
+			Military:     db.IsMil(icaoAddr),
+		}
+	}
+	aircraft.Rssi = sig
+	aircraft.LastPing = time.Now()
+	aircraft.Heard(receivers, aircraft.LastPing)
+
+	if es, ok := msg.(interface{ squitter() *ExtendedSquitter }); ok {
+		aircraft.LastES = aircraft.LastPing
+		if t.debug && es.squitter().DF == 18 {
+			logControlField(es.squitter().CF)
+		}
+	}
+
+	lastPos := aircraft.LastPos
+	t.apply(&aircraft, msg, receivers)
+	if aircraft.LastPos != lastPos {
+		aircraft.Mlat = isMlat
+		if len(receivers) > 0 {
+			aircraft.PositionSource = receivers[0].Receiver
+		}
+	}
+
+	// The next message from the aircraft is applied to this one, so it is
+	// stored before anything else sees it
+	stored := aircraft
+	t.aircraft.Store(icaoAddr, &stored)
+	return aircraft
+}
+
+// UpdateSbs applies a BaseStation message heard by receiver to the aircraft
+// that sent it, stores the aircraft and returns a copy of it. It must be
+// called from the goroutine that decodes, as it updates the same aircraft.
+func (t *Tracker) UpdateSbs(msg *sbs.Message, receiver string) types.AircraftData {
+	aircraft := msg.Merge(t.aircraft)
+	// BaseStation records carry no signal level
+	aircraft.Heard([]types.Reception{{Receiver: receiver, Rssi: math.Inf(-1)}}, aircraft.LastPing)
+	if msg.HasPosition {
+		aircraft.PositionSource = receiver
+	}
+
+	stored := aircraft
+	t.aircraft.Store(aircraft.IcaoAddr, &stored)
+	return aircraft
+}
+
+// recentES reports whether addr belongs to an aircraft recently heard in an
+// extended squitter. As any bit error in a reply yields some address from its
+// parity, only these are trusted.
+func (t *Tracker) recentES(addr uint32) bool {
+	aircraft, ok := t.aircraft.Load(addr)
+	return ok && !aircraft.ModeAC && time.Since(aircraft.LastES) <= apAddressTimeout
+}
+
+func logControlField(cf uint8) {
+	switch cf {
+	case 1:
+		log.Debugf("ES Non-ICAO")
+	case 2:
+		log.Debugf("ES TIS-B fine")
+	case 3:
+		log.Debugf("ES TIS-B coarse")
+	case 5:
+		log.Debugf("ES TIS-B anon ADS-B relay")
+	case 6:
+		log.Debugf("ES ADS-B rebroadcast")
+	default:
+		log.Debugf("ES Non-ICAO unknown")
+	}
+}
+
+// apply updates aircraft with the fields of msg, heard by receivers
+func (t *Tracker) apply(aircraft *types.AircraftData, msg Message, receivers []types.Reception) {
+	switch m := msg.(type) {
+	case *AltitudeReply:
+		setAltitude(aircraft, m.Altitude)
+	case *CommBAltitudeReply:
+		setAltitude(aircraft, m.Altitude)
+		applyCommB(aircraft, m.MB)
+	case *IdentityReply:
+		setSquawk(aircraft, m.Squawk)
+	case *CommBIdentityReply:
+		setSquawk(aircraft, m.Squawk)
+		applyCommB(aircraft, m.MB)
+
+	case *Identification:
+		if m.Callsign != "" {
+			aircraft.Callsign = m.Callsign
+		}
+		if m.Category != 0 {
+			aircraft.Category = m.Category
+		}
+
+	case *SurfacePosition:
+		t.updatePosition(aircraft, m.CPR, true, receivers)
+		setIntegrity(aircraft, m.TypeCode, false)
+
+	case *AirbornePosition:
+		t.updatePosition(aircraft, m.CPR, false, receivers)
+		setAltitude(aircraft, m.Altitude)
+		setIntegrity(aircraft, m.TypeCode, m.NICSupplementB)
+
+	case *AirborneVelocity:
+		applyVelocity(aircraft, m)
+		aircraft.NACv = m.NACv
+
+	case *AircraftStatus:
+		aircraft.EmergencyState = m.Emergency
+		aircraft.Emergency = m.Emergency != 0
+		setSquawk(aircraft, m.Squawk)
+
+	case *RABroadcast:
+		if m.Terminated {
+			aircraft.ACASRA = ""
+		} else {
+			aircraft.ACASRA = m.Advisory()
+		}
+
+	case *TargetState:
+		state := m.TargetState
+		aircraft.TargetState = &state
+
+	case *OperationalStatus:
+		status := m.OperationalStatus
+		aircraft.OpStatus = &status
+	}
+}
+
+// applyVelocity updates aircraft with the fields a velocity squitter has
+func applyVelocity(aircraft *types.AircraftData, m *AirborneVelocity) {
+	if m.GroundSpeed != math.MaxInt32 {
+		aircraft.Speed = m.GroundSpeed
+	}
+	if m.Track != math.MaxFloat64 {
+		aircraft.Track = m.Track
+		aircraft.Heading = int32(math.Round(m.Track)) % 360
+		aircraft.HeadingIsValid = true
+	}
+	setFloat(&aircraft.MagHeading, m.MagHeading)
+	if m.TrueAirspeed {
+		setInt(&aircraft.TAS, m.Airspeed)
+	} else {
+		setInt(&aircraft.IAS, m.Airspeed)
+	}
+	setInt(&aircraft.GeomOffset, m.GeomOffset)
+
+	if m.VertRate == math.MaxInt32 {
+		return
+	}
+	if m.VertRateSource == VertRateBaro {
+		aircraft.BaroRate = m.VertRate
+	} else {
+		aircraft.GeomRate = m.VertRate
+	}
+	// The unsigned rate and its sign are kept for the outputs
+	aircraft.VertRateSource = m.VertRateSource
+	aircraft.VertRate = abs32(m.VertRate)
+	aircraft.VertRateSign = 0
+	if m.VertRate < 0 {
+		aircraft.VertRateSign = 1
+	}
+}
+
+// applyCommB updates aircraft with the register most likely held by the MB
+// field of a Comm-B reply, unless it may well be another
+func applyCommB(aircraft *types.AircraftData, mb [7]byte) {
+	ref := CommBReference{Altitude: aircraft.Altitude, Callsign: aircraft.Callsign}
+	if !aircraft.Surface && aircraft.Speed > 0 {
+		ref.GroundSpeed = aircraft.Speed
+		ref.Track = aircraft.Heading
+	}
+
+	candidates := DecodeCommB(mb, ref)
+	if len(candidates) == 0 {
+		CommBUnknown.Inc(1)
+		return
+	}
+	best := candidates[0]
+	if best.Confidence < minCommBConfidence {
+		CommBAmbiguous.Inc(1)
+		return
+	}
+	metrics.GetOrRegisterCounter(fmt.Sprintf("Comm-B (BDS %X,%X)", best.Register.BDS()>>4, best.Register.BDS()&15), nil).Inc(1)
+
+	cb := &aircraft.CommB
+	switch r := best.Register.(type) {
+	case *DataLinkCapability:
+		cb.SubnetVersion = r.SubnetVersion
+	case *GICBCapability:
+		cb.GICB = r.Registers
+	case *AircraftIdentification:
+		aircraft.Callsign = r.Callsign
+	case *ACASResolution:
+		if r.Terminated {
+			cb.ACASRA = ""
+		} else {
+			cb.ACASRA = r.Advisory()
+		}
+	case *VerticalIntention:
+		setInt(&cb.SelAltitude, r.MCPAltitude)
+		setInt(&cb.FMSAltitude, r.FMSAltitude)
+		setFloat(&cb.BaroSetting, r.BaroSetting)
+	case *TrackAndTurn:
+		setFloat(&cb.Roll, r.Roll)
+		setFloat(&cb.TrueTrack, r.TrueTrack)
+		setInt(&cb.GroundSpeed, r.GroundSpeed)
+		setFloat(&cb.TrackRate, r.TrackRate)
+		setInt(&cb.TAS, r.TAS)
+	case *HeadingAndSpeed:
+		setFloat(&cb.MagHeading, r.MagHeading)
+		setInt(&cb.IAS, r.IAS)
+		setFloat(&cb.Mach, r.Mach)
+		setInt(&cb.BaroRate, r.BaroRate)
+		setInt(&cb.InertialRate, r.InertialRate)
+	}
+	cb.BDS = best.Register.BDS()
+	cb.Confidence = best.Confidence
+	cb.Updated = aircraft.LastPing
+}
+
+// setInt and setFloat keep the previous value of fields that are not known
+func setInt(field *int32, v int32) {
+	if v != math.MaxInt32 {
+		*field = v
+	}
+}
+
+func setFloat(field *float64, v float64) {
+	if v != math.MaxFloat64 {
+		*field = v
+	}
+}
+
+// setIntegrity sets the integrity of the latest position from the tables of
+// the ADS-B version of the aircraft, version 0 until an operational status
+// tells otherwise
+func setIntegrity(aircraft *types.AircraftData, tc uint8, nicB bool) {
+	var version uint8
+	var nicA, nicC bool
+	if status := aircraft.OpStatus; status != nil {
+		version, nicA, nicC = status.Version, status.NICSupplementA, status.NICSupplementC
+	}
+	i := positionIntegrity(tc, version, nicA, nicB, nicC)
+	aircraft.NIC, aircraft.Rc = i.nic, i.rc
+}
+
+func setAltitude(aircraft *types.AircraftData, altitude int32) {
+	if altitude != math.MaxInt32 {
+		aircraft.Altitude = altitude
+	}
+}
+
+func setSquawk(aircraft *types.AircraftData, squawk uint32) {
+	if squawk != 0 {
+		aircraft.Squawk = squawk
+	}
+}
+
+// updatePosition decodes the position of aircraft from cpr and the other half
+// of the latest even/odd pair, or else from cpr alone relative to a recent
+// position. Surface positions, and airborne ones of receivers that hear no
+// further than half a zone, may also be relative to the receiver. The position
+// is only taken when it is valid.
+func (t *Tracker) updatePosition(aircraft *types.AircraftData, cpr CPR, surface bool, receivers []types.Reception) {
+	now := time.Now()
+	if aircraft.Surface != surface {
+		// Airborne and surface positions do not pair
+		aircraft.ERawLat, aircraft.ERawLon = math.MaxUint32, math.MaxUint32
+		aircraft.ORawLat, aircraft.ORawLon = math.MaxUint32, math.MaxUint32
+		if surface {
+			// The airborne ground speed is stale once landed, and surface
+			// movement is not decoded
+			aircraft.Speed = 0
+		}
+		aircraft.Surface = surface
+	}
+	if cpr.Odd {
+		aircraft.ORawLat, aircraft.ORawLon, aircraft.ORawTime = cpr.RawLat, cpr.RawLon, now
+	} else {
+		aircraft.ERawLat, aircraft.ERawLon, aircraft.ERawTime = cpr.RawLat, cpr.RawLon, now
+	}
+
+	ranges := t.receiverRanges(receivers)
+	var ref *CPRRef
+	if aircraft.Latitude != math.MaxFloat64 && now.Sub(aircraft.LastPos) <= cprLocalMaxAge {
+		ref = &CPRRef{Lat: aircraft.Latitude, Lon: aircraft.Longitude}
+	} else if pos := localReference(ranges, surface); pos != nil {
+		ref = &CPRRef{Lat: pos.Lat(), Lon: pos.Lng()}
+	}
+
+	timeout := cprAirbornePairTimeout
+	if surface {
+		timeout = cprSurfacePairTimeout
+	}
+	pairAge := aircraft.ORawTime.Sub(aircraft.ERawTime)
+	if pairAge < 0 {
+		pairAge = -pairAge
+	}
+
+	var latitude, longitude float64
+	ok := false
+	if aircraft.ERawLat != math.MaxUint32 && aircraft.ORawLat != math.MaxUint32 && pairAge <= timeout {
+		even := CPR{RawLat: aircraft.ERawLat, RawLon: aircraft.ERawLon}
+		odd := CPR{RawLat: aircraft.ORawLat, RawLon: aircraft.ORawLon, Odd: true}
+		latitude, longitude, ok = decodeGlobalCPR(even, odd, cpr.Odd, surface, ref)
+	}
+	if !ok && ref != nil {
+		latitude, longitude, ok = decodeLocalCPR(cpr, surface, *ref)
+	}
+	if !ok {
+		return
+	}
+
+	if !t.validPosition(aircraft, latitude, longitude, ranges, now) {
+		if t.debug {
+			log.Debugf("Skipping position %.5f, %.5f of aircraft %06x", latitude, longitude, aircraft.IcaoAddr)
+		}
+		return
+	}
+
+	acRange := 0.0
+	if t.home != nil {
+		acpos := geo.NewPoint(latitude, longitude)
+		acRange = math.Round((t.home.GreatCircleDistance(acpos)*0.539957)*1000) / 1000
+	}
+	aircraft.Range = acRange
+	aircraft.Latitude = latitude
+	aircraft.Longitude = longitude
+	aircraft.LastPos = now
+}
@@ -0,0 +1,174 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"time"
+
+	"github.com/ccustine/beastie/types"
+	"github.com/kellydunn/golang-geo"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// kmPerNM converts the distances of golang-geo
+	kmPerNM = 1.852
+
+	// Speeds in kt that no aircraft is taken to exceed when it does not
+	// report its own, airborne and on the surface
+	maxAirborneSpeed = 700
+	maxSurfaceSpeed  = 100
+)
+
+var (
+	PositionRange       = metrics.GetOrRegisterCounter("Position (Rejected Range)", metrics.DefaultRegistry)
+	PositionSpeed       = metrics.GetOrRegisterCounter("Position (Rejected Speed)", metrics.DefaultRegistry)
+	PositionUnconfirmed = metrics.GetOrRegisterCounter("Position (Unconfirmed)", metrics.DefaultRegistry)
+)
+
+// distance returns the great circle distance between two positions in km
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	return geo.NewPoint(lat1, lon1).GreatCircleDistance(geo.NewPoint(lat2, lon2))
+}
+
+// plausibleDistance returns how many km an aircraft can have covered in
+// elapsed. The ground speed it reports is allowed a margin, a second is added
+// for the time between receiving a position and it being decoded and the base
+// covers the resolution of the positions.
+func plausibleDistance(speed int32, surface bool, elapsed time.Duration) float64 {
+	var kt, base float64
+	if surface {
+		kt, base = maxSurfaceSpeed, 0.1
+		if speed > 0 {
+			kt = math.Min(math.Max(float64(speed)*2, 20), 150)
+		}
+	} else {
+		kt, base = maxAirborneSpeed, 0.5
+		if speed > 0 {
+			kt = math.Max(float64(speed)*4/3, 200)
+		}
+	}
+	hours := (elapsed + time.Second).Hours()
+	return base + kt*kmPerNM*hours
+}
+
+// receiverRange is where a receiver is and how far it hears
+type receiverRange struct {
+	pos      *geo.Point // Unknown when nil
+	maxRange float64    // NM, 0 for no limit
+}
+
+// newReceiverRange places a receiver at lat, lon, home when both are 0, with
+// maxRange or the default range when that is 0
+func (t *Tracker) newReceiverRange(lat, lon, maxRange float64) receiverRange {
+	r := receiverRange{pos: t.home, maxRange: maxRange}
+	if lat != 0 || lon != 0 {
+		r.pos = geo.NewPoint(lat, lon)
+	}
+	if r.maxRange <= 0 {
+		r.maxRange = t.maxRange
+	}
+	return r
+}
+
+// receiverRanges returns the location and range of each of the receivers,
+// those of home for receivers that are not placed on their own or when there
+// are none
+func (t *Tracker) receiverRanges(receivers []types.Reception) []receiverRange {
+	if len(receivers) == 0 {
+		return []receiverRange{{pos: t.home, maxRange: t.maxRange}}
+	}
+	ranges := make([]receiverRange, 0, len(receivers))
+	for _, r := range receivers {
+		rr, ok := t.ranges[r.Receiver]
+		if !ok {
+			rr = receiverRange{pos: t.home, maxRange: t.maxRange}
+		}
+		ranges = append(ranges, rr)
+	}
+	return ranges
+}
+
+// inRange reports whether any of the receivers can hear a position, which it
+// can when the receiver is unplaced or has no limit
+func inRange(ranges []receiverRange, lat, lon float64) bool {
+	for _, r := range ranges {
+		if r.pos == nil || r.maxRange <= 0 || distance(r.pos.Lat(), r.pos.Lng(), lat, lon) <= r.maxRange*kmPerNM {
+			return true
+		}
+	}
+	return false
+}
+
+// localReference returns the location of a receiver that hears aircraft
+// within half a zone, 45 NM on the surface, to decode a single message
+// against, or nil when none does
+func localReference(ranges []receiverRange, surface bool) *geo.Point {
+	for _, r := range ranges {
+		if r.pos != nil && (surface || r.maxRange > 0 && r.maxRange <= cprLocalMaxRange) {
+			return r.pos
+		}
+	}
+	return nil
+}
+
+// validPosition reports whether aircraft can be at the position it was
+// decoded to. Positions beyond the range of every receiver that heard it, from
+// where each of them is, are rejected, as are
+// those that are further from the previous one than the aircraft can have
+// flown since. A new aircraft, or one that keeps being seen elsewhere, has to
+// be at minPositions consistent positions before its position is shown.
+func (t *Tracker) validPosition(aircraft *types.AircraftData, lat, lon float64, ranges []receiverRange, now time.Time) bool {
+	if !inRange(ranges, lat, lon) {
+		PositionRange.Inc(1)
+		return false
+	}
+
+	if aircraft.Latitude != math.MaxFloat64 {
+		d := distance(aircraft.Latitude, aircraft.Longitude, lat, lon)
+		if d <= plausibleDistance(aircraft.Speed, aircraft.Surface, now.Sub(aircraft.LastPos)) {
+			aircraft.PendingCount = 0
+			return true
+		}
+	}
+
+	// Positions that disagree with the one shown start a track of their own,
+	// which replaces it once it is confirmed
+	if aircraft.PendingCount > 0 {
+		d := distance(aircraft.PendingLat, aircraft.PendingLon, lat, lon)
+		if d > plausibleDistance(aircraft.Speed, aircraft.Surface, now.Sub(aircraft.PendingPos)) {
+			aircraft.PendingCount = 0
+		}
+	}
+	aircraft.PendingLat, aircraft.PendingLon, aircraft.PendingPos = lat, lon, now
+	aircraft.PendingCount++
+	need := t.minPositions
+	if aircraft.Latitude != math.MaxFloat64 && need < 2 {
+		// A single position never outweighs the one shown
+		need = 2
+	}
+	if aircraft.PendingCount >= need {
+		aircraft.PendingCount = 0
+		return true
+	}
+
+	if aircraft.Latitude != math.MaxFloat64 {
+		PositionSpeed.Inc(1)
+	} else {
+		PositionUnconfirmed.Inc(1)
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/types"
+	"github.com/kellydunn/golang-geo"
+)
+
+func TestTracker_inRange(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{Homepos: geo.NewPoint(52, 4), MaxRange: 400,
+		Sources: []config.Source{
+			{Host: "localhost", Port: 30005, MaxRange: 100},
+			{Host: "remote", Port: 30005, Latitude: 40, Longitude: -105, MaxRange: 100},
+			{File: "replay.bin"},
+		},
+		Receivers: []config.Receiver{{Name: "192.0.2.1", Latitude: 48.85, Longitude: 2.35}}})
+	unlimited := NewTracker(types.NewAircraftMap(), &config.BeastInfo{Homepos: geo.NewPoint(52, 4)})
+
+	tests := []struct {
+		name      string
+		tracker   *Tracker
+		receivers []string
+		lat, lon  float64
+		want      bool
+	}{
+		{"no receivers", tracker, nil, 58, 4, true},
+		{"beyond the default range", tracker, nil, 59, 4, false},
+		{"own range", tracker, []string{"localhost:30005"}, 53.5, 4, true},
+		{"beyond own range", tracker, []string{"localhost:30005"}, 53.7, 4, false},
+		{"default range", tracker, []string{"replay.bin"}, 58, 4, true},
+		{"any receiver", tracker, []string{"localhost:30005", "rtl"}, 58, 4, true},
+		{"from the source", tracker, []string{"remote:30005"}, 41.5, -105, true},
+		{"beyond the source", tracker, []string{"remote:30005"}, 52, 4, false},
+		{"from the feeder", tracker, []string{"192.0.2.1"}, 43, 2.35, true},
+		{"beyond the feeder", tracker, []string{"192.0.2.1"}, 42, 2.35, false},
+		{"no limit", unlimited, []string{"rtl"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var receivers []types.Reception
+			for _, r := range tt.receivers {
+				receivers = append(receivers, types.Reception{Receiver: r})
+			}
+			if got := inRange(tt.tracker.receiverRanges(receivers), tt.lat, tt.lon); got != tt.want {
+				t.Errorf("inRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalReference(t *testing.T) {
+	home, feeder := geo.NewPoint(52, 4), geo.NewPoint(48.85, 2.35)
+	tests := []struct {
+		name    string
+		ranges  []receiverRange
+		surface bool
+		want    *geo.Point
+	}{
+		{"unplaced", []receiverRange{{maxRange: 100}}, false, nil},
+		{"no limit", []receiverRange{{pos: home}}, false, nil},
+		{"no limit on the surface", []receiverRange{{pos: home}}, true, home},
+		{"too far", []receiverRange{{pos: home, maxRange: 400}}, false, nil},
+		{"first within half a zone", []receiverRange{{pos: home, maxRange: 400}, {pos: feeder, maxRange: 150}}, false, feeder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localReference(tt.ranges, tt.surface); got != tt.want {
+				t.Errorf("localReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_validPosition(t *testing.T) {
+	tracker := NewTracker(types.NewAircraftMap(), &config.BeastInfo{Homepos: geo.NewPoint(52, 4), MaxRange: 100, MinPositions: 2})
+	ranges := tracker.receiverRanges(nil)
+	aircraft := &types.AircraftData{Latitude: math.MaxFloat64, Longitude: math.MaxFloat64}
+	now := time.Now()
+	show := func(lat, lon float64) {
+		aircraft.Latitude, aircraft.Longitude, aircraft.LastPos = lat, lon, now
+	}
+
+	// A new aircraft needs two consistent positions
+	unconfirmed := PositionUnconfirmed.Count()
+	if tracker.validPosition(aircraft, 52.2, 4, ranges, now) {
+		t.Errorf("validPosition() = true for the first position")
+	}
+	if PositionUnconfirmed.Count() != unconfirmed+1 {
+		t.Errorf("validPosition() counted %d unconfirmed, want 1", PositionUnconfirmed.Count()-unconfirmed)
+	}
+	now = now.Add(time.Second)
+	if !tracker.validPosition(aircraft, 52.201, 4, ranges, now) {
+		t.Fatalf("validPosition() = false for the second position")
+	}
+	show(52.201, 4)
+
+	// At 450 kt it covers some 2.5 km in 10 s, not 90
+	aircraft.Speed = 450
+	now = now.Add(10 * time.Second)
+	if !tracker.validPosition(aircraft, 52.22, 4, ranges, now) {
+		t.Errorf("validPosition() = false 2.1 km on")
+	}
+	show(52.22, 4)
+	speed := PositionSpeed.Count()
+	now = now.Add(10 * time.Second)
+	if tracker.validPosition(aircraft, 53.02, 4, ranges, now) {
+		t.Errorf("validPosition() = true 89 km on in 10 s")
+	}
+	if PositionSpeed.Count() != speed+1 {
+		t.Errorf("validPosition() counted %d too fast, want 1", PositionSpeed.Count()-speed)
+	}
+
+	// Until the aircraft keeps being seen there
+	now = now.Add(time.Second)
+	if !tracker.validPosition(aircraft, 53.021, 4, ranges, now) {
+		t.Errorf("validPosition() = false for a confirmed track")
+	}
+
+	// Further than the receiver hears
+	outOfRange := PositionRange.Count()
+	if tracker.validPosition(aircraft, 53.7, 4, ranges, now) {
+		t.Errorf("validPosition() = true 102 NM away")
+	}
+	if PositionRange.Count() != outOfRange+1 {
+		t.Errorf("validPosition() counted %d out of range, want 1", PositionRange.Count()-outOfRange)
+	}
+}
+
+func TestPlausibleDistance(t *testing.T) {
+	tests := []struct {
+		name    string
+		speed   int32
+		surface bool
+		elapsed time.Duration
+		want    float64
+	}{
+		{"unknown speed", 0, false, 35 * time.Second, 0.5 + 700*1.852/100},
+		{"slow", 90, false, 17 * time.Second, 0.5 + 200*1.852/200},
+		{"fast", 450, false, 17 * time.Second, 0.5 + 600*1.852/200},
+		{"surface unknown speed", 0, true, 35 * time.Second, 0.1 + 100*1.852/100},
+		{"taxiing", 15, true, 35 * time.Second, 0.1 + 30*1.852/100},
+		{"take-off roll", 140, true, 35 * time.Second, 0.1 + 150*1.852/100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plausibleDistance(tt.speed, tt.surface, tt.elapsed); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("plausibleDistance() = %.3f km, want %.3f", got, tt.want)
+			}
+		})
+	}
+}
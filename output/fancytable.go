@@ -23,6 +23,7 @@ import (
 	"github.com/ccustine/beastie/registry"
 	"github.com/ccustine/beastie/types"
 	"github.com/dgraph-io/badger"
+	"github.com/dustin/go-humanize"
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 	"github.com/kellydunn/golang-geo"
@@ -59,11 +60,14 @@ type FancyTable struct {
 	act        *termui.Table
 	g          *ui.Grid
 	msgRate    *widgets.Plot
+	filter     *CategoryFilter
 	Beastinfo  *config.BeastInfo
 	i          *widgets.Paragraph
 	sortMethod string
 	sortAsc    bool
 	acinfo     *widgets.Paragraph
+	sources    *widgets.Paragraph
+	modeAC     *widgets.Paragraph
 	db         *badger.DB
 	isClosing  bool
 	group      *sync.WaitGroup
@@ -270,14 +274,14 @@ func NewFancyTableOutput(info *config.BeastInfo, group *sync.WaitGroup, done cha
 	//	3, 6, 8, 4, 15, 5, 4, 4, 3, 3, 5, 4,
 	//}
 
-	act.Header = []string{"#", "ICAO", "Call", "Squawk", "Lat/Lon", "Alt", "Rate", "Speed", "Hdg", "Rng", "Last"}
+	act.Header = []string{"#", "ICAO", "Call", "Cat", "Squawk", "Lat/Lon", "Alt", "Rate", "Speed", "Hdg", "Rng", "Last"}
 
 	//act.Rows = make([][]string, 2)
 	//act.Rows[0] = []string{"#", "ICAO", "Call", "Squawk", "Lat/Lon", "Alt", "Rate", "Speed", "Hdg", "Rng", "Last"}
 
 	act.ColResizer = func() {
 		act.ColWidths = []int{
-			4, 7, 9, 7, 18, 8, 6, 6, 4, 6, 6,
+			4, 7, 9, 4, 7, 18, 8, 6, 6, 4, 6, 6,
 		}
 	}
 
@@ -285,6 +289,12 @@ func NewFancyTableOutput(info *config.BeastInfo, group *sync.WaitGroup, done cha
 
 	acInfo := widgets.NewParagraph()
 
+	sources := widgets.NewParagraph()
+	sources.Title = " Sources "
+
+	modeAC := widgets.NewParagraph()
+	modeAC.Title = " Mode A/C "
+
 	msgRate := widgets.NewPlot()
 	msgRate.Title = "Msg Rate"
 	msgRate.Data = make([][]float64, 1)
@@ -311,8 +321,10 @@ func NewFancyTableOutput(info *config.BeastInfo, group *sync.WaitGroup, done cha
 			ui.NewCol(1.0/3*2, act),
 			ui.NewCol(1.0/3,
 				ui.NewRow(1.0/8, msgRate),
-				ui.NewRow(1.0/8, infoPar),
-				ui.NewRow(1.0/8*6, acInfo),
+				ui.NewRow(1.0/8*2, infoPar),
+				ui.NewRow(1.0/8*2, sources),
+				ui.NewRow(1.0/8, modeAC),
+				ui.NewRow(1.0/8*2, acInfo),
 			),
 
 		),
@@ -330,7 +342,7 @@ func NewFancyTableOutput(info *config.BeastInfo, group *sync.WaitGroup, done cha
 	checkErr(err)
 
 	group.Add(1)
-	table := &FancyTable{Beastinfo: info, act: act, done: done, group: group, sortMethod: "r", sortAsc: true, db: db, acinfo: acInfo, i: infoPar, h: h, g: grid, Table: act, msgRate: msgRate,}
+	table := &FancyTable{Beastinfo: info, act: act, done: done, group: group, sortMethod: "r", sortAsc: true, db: db, acinfo: acInfo, sources: sources, modeAC: modeAC, i: infoPar, h: h, g: grid, Table: act, msgRate: msgRate, filter: NewCategoryFilter(info),}
 	table.CursorColor = ui.ColorCyan
 	table.ShowCursor = true
 	table.UniqueCol = 1
@@ -373,6 +385,9 @@ func (o *FancyTable) UpdateDisplay(knownAircraft []*types.AircraftData) { //*typ
 	BadRate := metrics.GetOrRegisterMeter("Message Rate (Bad)", metrics.DefaultRegistry)
 	RtlGoodRate := metrics.GetOrRegisterMeter("Message Rate (RTL Good)", metrics.DefaultRegistry)
 	RtlBadRate := metrics.GetOrRegisterMeter("Message Rate (RTL Bad)", metrics.DefaultRegistry)
+	RtlStrongRate := metrics.GetOrRegisterMeter("Message Rate (RTL Strong)", metrics.DefaultRegistry)
+	RtlWeakRate := metrics.GetOrRegisterMeter("Message Rate (RTL Weak)", metrics.DefaultRegistry)
+	RtlNoiseFloor := metrics.GetOrRegisterGaugeFloat64("Noise Floor (RTL)", metrics.DefaultRegistry)
 
 	goodRate := GoodRate.Rate1()
 	badRate := BadRate.Rate1()
@@ -400,40 +415,99 @@ func (o *FancyTable) UpdateDisplay(knownAircraft []*types.AircraftData) { //*typ
 	ModesLongCnt := metrics.GetOrRegisterCounter("Message Rate (ModeS Long)", metrics.DefaultRegistry)
 
 	o.i.Text = fmt.Sprintf("Message Rate [(Good)](fg:green): %.1f/s\nMessage Rate [(Bad)](fg:red) : %.1f/s\nMessage Rate [(RTL Good)](fg:green) : %.1f/s\nMessage Rate [(RTL Bad)](fg:red) : %.1f/s\n", goodRate, badRate, RtlGoodRate.Rate1(), RtlBadRate.Rate1()) +
+		fmt.Sprintf("Message Rate (RTL Strong): %.1f/s\nMessage Rate (RTL Weak)  : %.1f/s\nNoise Floor (RTL): %.1f dBFS\n", RtlStrongRate.Rate1(), RtlWeakRate.Rate1(), RtlNoiseFloor.Value()) +
 		fmt.Sprintf("Message Count - Mode A/C:    %d\nMessage Count - ModeS Short: %d\nMessage Count - ModeS Long:  %d", ModeACCnt.Count(), ModesShortCnt.Count(), ModesLongCnt.Count())
 
+	o.sources.Text = sourcesToText(types.DefaultSourceRegistry.Statuses())
+	o.modeAC.Text = modeACToText(o.aircraft)
+
 	if !helpVisible {
 		renderLock.Lock()
 		ui.Render(o.msgRate)
 		ui.Render(o.i)
+		ui.Render(o.sources)
+		ui.Render(o.modeAC)
 		renderLock.Unlock()
 
 	}
 
 }
 
+// sourcesToText renders one line per source, colored by state
+func sourcesToText(statuses []types.SourceStatus) string {
+	var b strings.Builder
+	for _, status := range statuses {
+		color := "green"
+		switch status.State {
+		case types.SourceConnecting, types.SourceBackoff:
+			color = "yellow"
+		case types.SourceFailed:
+			color = "red"
+		}
+
+		last := "never"
+		if !status.LastFrame.IsZero() {
+			last = fmt.Sprintf("%ds ago", int(time.Since(status.LastFrame).Seconds()))
+		}
+
+		b.WriteString(fmt.Sprintf("[%s](fg:%s) %s: %d frames, %s, last %s, %d reconnects\n",
+			status.Name, color, status.State, status.Frames, humanize.Bytes(uint64(status.Bytes)), last, status.Reconnects))
+		if status.State != types.SourceConnected && status.LastError != "" {
+			b.WriteString(fmt.Sprintf("  [%s](fg:red)\n", status.LastError))
+		}
+	}
+	return b.String()
+}
+
+// modeACToText renders one line per Mode A/C only target. Each code may be an
+// identity or a Mode C altitude, so both are shown.
+func modeACToText(aircraft []types.AircraftData) string {
+	var targets []types.AircraftData
+	for _, a := range aircraft {
+		if a.ModeAC {
+			targets = append(targets, a)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Squawk < targets[j].Squawk
+	})
+
+	var b strings.Builder
+	for _, target := range targets {
+		b.WriteString(fmt.Sprintf("[%04x](fg:cyan)", target.Squawk))
+		if target.Altitude != math.MaxInt32 {
+			b.WriteString(fmt.Sprintf(" or %d ft", target.Altitude))
+		}
+		if target.Spi {
+			b.WriteString(" [ident](fg:yellow)")
+		}
+		b.WriteString(fmt.Sprintf(", last %ds ago\n", int(time.Since(target.LastPing).Seconds())))
+	}
+	return b.String()
+}
+
 // Sort sorts either the grouped or ungrouped []Process based on the sortMethod.
 // Called with every update, when the sort method is changed, and when processes are grouped and ungrouped.
 func (o *FancyTable) Sort() {
 	aircraftData := o.aircraft
-	o.Header = []string{"#", "ICAO", "Call", "Squawk", "Lat/Lon", "Alt", "Rate", "Speed", "Hdg", "Rng", "Last"}
+	o.Header = []string{"#", "ICAO", "Call", "Cat", "Squawk", "Lat/Lon", "Alt", "Rate", "Speed", "Hdg", "Rng", "Last"}
 
 	switch o.sortMethod {
 	case "s":
 		if o.sortAsc {
 			sort.Sort(AircraftBySpeed(aircraftData))
-			o.Header[7] += UP
+			o.Header[8] += UP
 		} else {
 			sort.Sort(sort.Reverse(AircraftBySpeed(aircraftData)))
-			o.Header[7] += DOWN
+			o.Header[8] += DOWN
 		}
 	case "r":
 		if o.sortAsc {
 			sort.Sort(AircraftByRange(aircraftData))
-			o.Header[9] += UP
+			o.Header[10] += UP
 		} else {
 			sort.Sort(sort.Reverse(AircraftByRange(aircraftData)))
-			o.Header[9] += DOWN
+			o.Header[10] += DOWN
 		}
 	}
 
@@ -471,8 +545,9 @@ func (o *FancyTable) FieldsToStrings(sortedAircraft []types.AircraftData) ([][]s
 
 	styles := make([][]ui.Style, len(sortedAircraft))
 	for i := range styles {
-		styles[i] = make([]ui.Style, 11)
+		styles[i] = make([]ui.Style, 12)
 	}
+	o.RowColors = map[int]ui.Color{}
 
 	index := 0
 	for _, aircraft := range sortedAircraft {
@@ -575,11 +650,16 @@ func (o *FancyTable) FieldsToStrings(sortedAircraft []types.AircraftData) ([][]s
 			mil = "*"
 		}
 
+		if o.filter.Highlighted(&aircraft) {
+			o.RowColors[len(rows)] = ui.ColorMagenta
+		}
+
 		rows = append(rows,
 			[]string{
 				fmt.Sprintf("%d", index),
 				fmt.Sprintf("%06x%s", aircraft.IcaoAddr, mil),
 				aircraft.Callsign,
+				aircraft.Category.String(),
 				squawk, //"[test](fg:red)",
 				sLatLon,
 				sAlt,
@@ -0,0 +1,65 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"github.com/ccustine/beastie/config"
+	"github.com/ccustine/beastie/types"
+)
+
+// CategoryFilter hides and highlights aircraft by emitter category, given as
+// codes such as A7 or whole sets such as C. Aircraft of unknown category are
+// neither.
+type CategoryFilter struct {
+	Hide      []string
+	Highlight []string
+}
+
+func NewCategoryFilter(info *config.BeastInfo) *CategoryFilter {
+	return &CategoryFilter{Hide: info.HideCategories, Highlight: info.HighlightCategories}
+}
+
+func matchesAny(category types.EmitterCategory, codes []string) bool {
+	for _, code := range codes {
+		if category.Matches(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hidden reports whether aircraft is left out of the outputs
+func (f *CategoryFilter) Hidden(aircraft *types.AircraftData) bool {
+	return matchesAny(aircraft.Category, f.Hide)
+}
+
+// Highlighted reports whether aircraft stands out in the table
+func (f *CategoryFilter) Highlighted(aircraft *types.AircraftData) bool {
+	return matchesAny(aircraft.Category, f.Highlight)
+}
+
+// Visible returns the aircraft that are not hidden
+func (f *CategoryFilter) Visible(knownAircraft []*types.AircraftData) []*types.AircraftData {
+	if len(f.Hide) == 0 {
+		return knownAircraft
+	}
+	visible := make([]*types.AircraftData, 0, len(knownAircraft))
+	for _, aircraft := range knownAircraft {
+		if !f.Hidden(aircraft) {
+			visible = append(visible, aircraft)
+		}
+	}
+	return visible
+}
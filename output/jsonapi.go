@@ -52,6 +52,7 @@ func NewJsonOutput() *JsonOutput {
 	r := mux.NewRouter()
 	r.HandleFunc("/aircraft", jsonApi.FeedHandler)
 	r.HandleFunc("/metrics", jsonApi.MetricsHandler)
+	r.HandleFunc("/sources", jsonApi.SourcesHandler)
 
 	server = &sse.Server{
 		//BufferSize: 1024,
@@ -150,6 +151,9 @@ func (o JsonOutput) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	modeACCnt := metrics.GetOrRegisterCounter("Message Rate (ModeA/C)", metrics.DefaultRegistry)
 	modesShortCnt := metrics.GetOrRegisterCounter("Message Rate (ModeS Short)", metrics.DefaultRegistry)
 	modesLongCnt := metrics.GetOrRegisterCounter("Message Rate (ModeS Long)", metrics.DefaultRegistry)
+	rtlStrongRate := metrics.GetOrRegisterMeter("Message Rate (RTL Strong)", metrics.DefaultRegistry)
+	rtlWeakRate := metrics.GetOrRegisterMeter("Message Rate (RTL Weak)", metrics.DefaultRegistry)
+	rtlNoiseFloor := metrics.GetOrRegisterGaugeFloat64("Noise Floor (RTL)", metrics.DefaultRegistry)
 
 	o.lock.RLock()
 	b.WriteString(fmt.Sprintf(`{"metrics":{"now": %d,
@@ -157,7 +161,11 @@ func (o JsonOutput) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 "bad":%.1f,
 "modea":%d,
 "modesshort":%d,
-"modeslong":%d`, time.Now().Unix(), goodRate.Rate1(), badRate.Rate1(), modeACCnt.Count(), modesShortCnt.Count(), modesLongCnt.Count()))
+"modeslong":%d,
+"rtlstrong":%.1f,
+"rtlweak":%.1f,
+"rtlnoise":%.1f`, time.Now().Unix(), goodRate.Rate1(), badRate.Rate1(), modeACCnt.Count(), modesShortCnt.Count(), modesLongCnt.Count(),
+		rtlStrongRate.Rate1(), rtlWeakRate.Rate1(), rtlNoiseFloor.Value()))
 	o.lock.RUnlock()
 	b.WriteString("}}")
 
@@ -166,6 +174,19 @@ func (o JsonOutput) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(b.String()))
 }
 
+func (o *JsonOutput) SourcesHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	body, err := json.Marshal(types.DefaultSourceRegistry.Statuses())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
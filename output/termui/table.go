@@ -22,6 +22,8 @@ type Table struct {
 	ShowCursor  bool
 	CursorColor Color
 
+	RowColors map[int]Color // Foreground of the rows that stand out, by row
+
 	ShowLocation bool
 
 	UniqueCol    int    // the column used to uniquely identify each table row
@@ -90,6 +92,9 @@ func (self *Table) Draw(buf *Buffer) {
 
 		// prints cursor
 		style := NewStyle(Theme.Default.Fg)
+		if fg, ok := self.RowColors[rowNum]; ok {
+			style.Fg = fg
+		}
 		if self.ShowCursor {
 			if (self.SelectedItem == "" && rowNum == self.SelectedRow) || (self.SelectedItem != "" && self.SelectedItem == row[self.UniqueCol]) {
 				style.Fg = self.CursorColor
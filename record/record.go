@@ -0,0 +1,292 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package record writes Beast streams to rotating, optionally compressed
+// files and reads them back for replay.
+//
+// Every file starts with a single header line naming the source, e.g.
+//
+//	BEASTIE-RECORD 1 source=piaware:30005 format=beast start=2018-11-05T21:09:27.041Z
+//
+// followed by the frames written to it. beastie writes each frame it reads
+// re-encoded as Beast, not the bytes of the wire: status frames and frames
+// that can not be parsed are dropped, and AVR frames are converted, with the
+// time they arrived as their timestamp when they have none.
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	GZIP = "gzip"
+	ZSTD = "zstd"
+
+	headerMagic   = "BEASTIE-RECORD"
+	headerVersion = 1
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type Options struct {
+	Dir      string
+	MaxSize  int64         // Rotate after this many uncompressed bytes, 0 to disable
+	MaxAge   time.Duration // Rotate after this long, 0 to disable
+	Compress string        // "", gzip or zstd
+}
+
+type Header struct {
+	Source string
+	Format string
+	Start  time.Time
+}
+
+func (h *Header) String() string {
+	return fmt.Sprintf("%s %d source=%s format=%s start=%s\n", headerMagic, headerVersion,
+		h.Source, h.Format, h.Start.UTC().Format(time.RFC3339Nano))
+}
+
+// Writer records a single source, starting a new file whenever the size or
+// age limit is reached.
+type Writer struct {
+	sync.Mutex
+	opts    Options
+	source  string
+	format  string
+	file    *os.File
+	out     io.Writer
+	closer  io.Closer
+	written int64
+	opened  time.Time
+	seq     int
+	closed  bool
+}
+
+func NewWriter(source string, format string, opts Options) (*Writer, error) {
+	switch opts.Compress {
+	case "", GZIP, ZSTD:
+	default:
+		return nil, fmt.Errorf("record: unknown compression %q", opts.Compress)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Writer{opts: opts, source: source, format: format}, nil
+}
+
+// Write appends p to the current file. Callers should write whole frames so
+// that rotation never splits one.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	if w.file == nil || w.needsRotation() {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.out.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close flushes and closes the current file. Later writes fail.
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	w.closed = true
+	return w.closeFile()
+}
+
+func (w *Writer) needsRotation() bool {
+	if w.opts.MaxSize > 0 && w.written >= w.opts.MaxSize {
+		return true
+	}
+	if w.opts.MaxAge > 0 && time.Since(w.opened) >= w.opts.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (w *Writer) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	w.opened = time.Now()
+	w.seq++
+	name := filepath.Join(w.opts.Dir, fmt.Sprintf("%s-%s-%04d.%s%s",
+		sanitize(w.source), w.opened.UTC().Format("20060102T150405Z"), w.seq, w.format, extension(w.opts.Compress)))
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.out = file
+	w.closer = nil
+
+	switch w.opts.Compress {
+	case GZIP:
+		gz := gzip.NewWriter(file)
+		w.out, w.closer = gz, gz
+	case ZSTD:
+		zw, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			w.file = nil
+			return err
+		}
+		w.out, w.closer = zw, zw
+	}
+
+	header := &Header{Source: w.source, Format: w.format, Start: w.opened}
+	n, err := io.WriteString(w.out, header.String())
+	w.written = int64(n)
+	return err
+}
+
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	var err error
+	if w.closer != nil {
+		err = w.closer.Close()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+type reader struct {
+	*bufio.Reader
+	closer io.Closer
+}
+
+func (r *reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// OpenReader undoes any compression on a recorded file and strips its header.
+// Files without a header, such as captures made with netcat, are returned as
+// they are with a nil Header. Closing the reader does not close r.
+func OpenReader(r io.Reader) (io.ReadCloser, *Header, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+
+	var stream io.Reader = br
+	var closer io.Closer
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		stream, closer = gz, gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc := zr.IOReadCloser()
+		stream, closer = rc, rc
+	}
+
+	sr := &reader{Reader: bufio.NewReader(stream), closer: closer}
+	peek, _ := sr.Peek(len(headerMagic))
+	if string(peek) != headerMagic {
+		return sr, nil, nil
+	}
+
+	line, err := sr.ReadString('\n')
+	if err == nil {
+		var header *Header
+		if header, err = parseHeader(line); err == nil {
+			return sr, header, nil
+		}
+	}
+	sr.Close()
+	return nil, nil, err
+}
+
+func parseHeader(line string) (*Header, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != headerMagic || fields[1] != fmt.Sprint(headerVersion) {
+		return nil, fmt.Errorf("record: unsupported header %q", strings.TrimSpace(line))
+	}
+
+	header := &Header{}
+	for _, field := range fields[2:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "source":
+			header.Source = kv[1]
+		case "format":
+			header.Format = kv[1]
+		case "start":
+			header.Start, _ = time.Parse(time.RFC3339Nano, kv[1])
+		}
+	}
+	return header, nil
+}
+
+func extension(compress string) string {
+	switch compress {
+	case GZIP:
+		return ".gz"
+	case ZSTD:
+		return ".zst"
+	}
+	return ""
+}
+
+func sanitize(source string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '/', '\\', ' ':
+			return '_'
+		}
+		return r
+	}, source)
+}
@@ -0,0 +1,94 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package record
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriter_RoundTrip(t *testing.T) {
+	frame := []byte{0x1a, '2', 0, 0, 0, 0, 0, 1, 0xff, 0x5d, 0x48, 0x40, 0xd6, 0x20, 0x2c, 0xc3}
+
+	for _, compress := range []string{"", GZIP, ZSTD} {
+		t.Run("compress="+compress, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "record")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// Small enough that the second frame starts a new file
+			w, err := NewWriter("piaware:30005", "beast", Options{Dir: dir, MaxSize: 80, Compress: compress})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := w.Write(frame); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(frame); err != os.ErrClosed {
+				t.Errorf("Write() after Close error = %v, want %v", err, os.ErrClosed)
+			}
+
+			files, _ := filepath.Glob(filepath.Join(dir, "piaware_30005-*"))
+			if len(files) != 2 {
+				t.Fatalf("got %d files, want 2", len(files))
+			}
+
+			for _, name := range files {
+				file, err := os.Open(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stream, header, err := OpenReader(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if header == nil || header.Source != "piaware:30005" || header.Format != "beast" || header.Start.IsZero() {
+					t.Errorf("OpenReader() header = %+v", header)
+				}
+				data, err := ioutil.ReadAll(stream)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, frame) {
+					t.Errorf("OpenReader() data = %x, want %x", data, frame)
+				}
+				stream.Close()
+				file.Close()
+			}
+		})
+	}
+}
+
+func TestOpenReader_NoHeader(t *testing.T) {
+	raw := []byte{0x1a, '1', 0, 0, 0, 0, 0, 1, 0xff, 0x12, 0x34}
+	stream, header, err := OpenReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(stream)
+	if header != nil || !bytes.Equal(data, raw) {
+		t.Errorf("OpenReader() = %x, %+v, want %x, nil", data, header, raw)
+	}
+}
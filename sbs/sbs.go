@@ -0,0 +1,254 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sbs parses the SBS-1 BaseStation CSV format served on port 30003.
+// http://woodair.net/sbs/article/barebones42_socket_data.htm
+package sbs
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccustine/beastie/db"
+	"github.com/ccustine/beastie/types"
+)
+
+const (
+	fieldCount = 22
+
+	fMessageType  = 0
+	fTransmission = 1
+	fHexIdent     = 4
+	fCallsign     = 10
+	fAltitude     = 11
+	fGroundSpeed  = 12
+	fTrack        = 13
+	fLatitude     = 14
+	fLongitude    = 15
+	fVerticalRate = 16
+	fSquawk       = 17
+	fAlert        = 18
+	fEmergency    = 19
+	fSpi          = 20
+	fOnGround     = 21
+)
+
+var (
+	ErrNotMsg   = errors.New("sbs: not a MSG record")
+	ErrBadField = errors.New("sbs: malformed field")
+)
+
+// Message is a single MSG record. Fields that were empty in the record are
+// marked as absent by their Has flag.
+type Message struct {
+	Transmission int
+	IcaoAddr     uint32
+
+	Callsign    string
+	HasCallsign bool
+
+	Altitude    int32
+	HasAltitude bool
+
+	GroundSpeed int32
+	HasSpeed    bool
+
+	Track    int32
+	HasTrack bool
+
+	Latitude    float64
+	Longitude   float64
+	HasPosition bool
+
+	VertRate    int32
+	HasVertRate bool
+
+	Squawk    uint32
+	HasSquawk bool
+
+	Alert        bool
+	Emergency    bool
+	Spi          bool
+	OnGround     bool
+	HasAlert     bool
+	HasEmergency bool
+	HasSpi       bool
+	HasOnGround  bool
+}
+
+// Parse decodes one line of BaseStation output.
+func Parse(line string) (*Message, error) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) < fieldCount || fields[fMessageType] != "MSG" {
+		return nil, ErrNotMsg
+	}
+
+	var err error
+	m := &Message{}
+
+	if m.Transmission, err = strconv.Atoi(fields[fTransmission]); err != nil {
+		return nil, ErrBadField
+	}
+
+	icao, err := strconv.ParseUint(fields[fHexIdent], 16, 32)
+	if err != nil {
+		return nil, ErrBadField
+	}
+	m.IcaoAddr = uint32(icao)
+
+	if callsign := strings.TrimSpace(fields[fCallsign]); callsign != "" {
+		m.Callsign, m.HasCallsign = callsign, true
+	}
+
+	if m.Altitude, m.HasAltitude, err = parseInt(fields[fAltitude]); err != nil {
+		return nil, err
+	}
+	if m.GroundSpeed, m.HasSpeed, err = parseInt(fields[fGroundSpeed]); err != nil {
+		return nil, err
+	}
+	if m.Track, m.HasTrack, err = parseInt(fields[fTrack]); err != nil {
+		return nil, err
+	}
+	if m.VertRate, m.HasVertRate, err = parseInt(fields[fVerticalRate]); err != nil {
+		return nil, err
+	}
+
+	if fields[fLatitude] != "" && fields[fLongitude] != "" {
+		if m.Latitude, err = strconv.ParseFloat(fields[fLatitude], 64); err != nil {
+			return nil, ErrBadField
+		}
+		if m.Longitude, err = strconv.ParseFloat(fields[fLongitude], 64); err != nil {
+			return nil, ErrBadField
+		}
+		m.HasPosition = true
+	}
+
+	if fields[fSquawk] != "" {
+		// Squawks are kept as hex so that 7700 prints as 7700
+		squawk, err := strconv.ParseUint(fields[fSquawk], 16, 32)
+		if err != nil {
+			return nil, ErrBadField
+		}
+		m.Squawk, m.HasSquawk = uint32(squawk), true
+	}
+
+	m.Alert, m.HasAlert = parseFlag(fields[fAlert])
+	m.Emergency, m.HasEmergency = parseFlag(fields[fEmergency])
+	m.Spi, m.HasSpi = parseFlag(fields[fSpi])
+	m.OnGround, m.HasOnGround = parseFlag(strings.TrimSpace(fields[fOnGround]))
+
+	return m, nil
+}
+
+// Merge applies the message to the matching aircraft in knownAircraft, or to a
+// new aircraft if it has not been seen before, and returns the updated copy.
+func (m *Message) Merge(knownAircraft *types.AircraftMap) types.AircraftData {
+	var aircraft types.AircraftData
+
+	if ptrAircraft, ok := knownAircraft.Load(m.IcaoAddr); ok {
+		aircraft = *ptrAircraft
+	} else {
+		aircraft = types.AircraftData{
+			IcaoAddr:     m.IcaoAddr,
+			ORawLat:      math.MaxUint32,
+			ORawLon:      math.MaxUint32,
+			ERawLat:      math.MaxUint32,
+			ERawLon:      math.MaxUint32,
+			Latitude:     math.MaxFloat64,
+			Longitude:    math.MaxFloat64,
+			Altitude:     math.MaxInt32,
+			VertRateSign: math.MaxUint32,
+			IsValid:      true,
+			Country:      db.IcaoToCountry(m.IcaoAddr),
+			Military:     db.IsMil(m.IcaoAddr),
+		}
+	}
+
+	m.Apply(&aircraft)
+	aircraft.LastPing = time.Now()
+
+	return aircraft
+}
+
+// Apply copies every field present in the message onto the aircraft.
+func (m *Message) Apply(aircraft *types.AircraftData) {
+	if m.HasCallsign {
+		aircraft.Callsign = m.Callsign
+	}
+	if m.HasAltitude {
+		aircraft.Altitude = m.Altitude
+	}
+	if m.HasSpeed {
+		aircraft.Speed = m.GroundSpeed
+	}
+	if m.HasTrack {
+		aircraft.Heading = m.Track
+		aircraft.HeadingIsValid = true
+	}
+	if m.HasPosition {
+		aircraft.Latitude = m.Latitude
+		aircraft.Longitude = m.Longitude
+		aircraft.LastPos = time.Now()
+	}
+	if m.HasVertRate {
+		if m.VertRate < 0 {
+			aircraft.VertRateSign = 1
+			aircraft.VertRate = -m.VertRate
+		} else {
+			aircraft.VertRateSign = 0
+			aircraft.VertRate = m.VertRate
+		}
+	}
+	if m.HasSquawk {
+		aircraft.Squawk = m.Squawk
+	}
+	if m.HasAlert {
+		aircraft.Alert = m.Alert
+	}
+	if m.HasEmergency {
+		aircraft.Emergency = m.Emergency
+	}
+	if m.HasSpi {
+		aircraft.Spi = m.Spi
+	}
+	if m.HasOnGround {
+		aircraft.Surface = m.OnGround
+	}
+}
+
+func parseInt(field string) (int32, bool, error) {
+	if field == "" {
+		return 0, false, nil
+	}
+	// Some feeders send speed and track with decimals
+	v, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, false, ErrBadField
+	}
+	return int32(math.Round(v)), true, nil
+}
+
+// Flags are sent as -1 for true and 0 for false
+func parseFlag(field string) (bool, bool) {
+	switch field {
+	case "-1", "1":
+		return true, true
+	case "0":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,70 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbs
+
+import (
+	"testing"
+
+	"github.com/ccustine/beastie/types"
+)
+
+func TestMessage_Merge(t *testing.T) {
+	knownAircraft := types.NewAircraftMap()
+
+	lines := []string{
+		"MSG,1,111,11111,A6C6C8,111111,2018/11/05,21:09:27.041,2018/11/05,21:09:27.041,ASA460  ,,,,,,,,,,,0",
+		"MSG,3,111,11111,A6C6C8,111111,2018/11/05,21:09:27.284,2018/11/05,21:09:27.284,,35000,,,40.12345,-104.54321,,,0,0,0,0",
+		"MSG,4,111,11111,A6C6C8,111111,2018/11/05,21:09:27.512,2018/11/05,21:09:27.512,,,451.4,281.9,,,-1088,,,,,0",
+		"MSG,6,111,11111,A6C6C8,111111,2018/11/05,21:09:28.018,2018/11/05,21:09:28.018,,35000,,,,,,7700,-1,-1,-1,0",
+	}
+
+	var aircraft types.AircraftData
+	for _, line := range lines {
+		msg, err := Parse(line)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", line, err)
+		}
+		aircraft = msg.Merge(knownAircraft)
+		knownAircraft.Store(aircraft.IcaoAddr, &aircraft)
+	}
+
+	if aircraft.IcaoAddr != 0xa6c6c8 || aircraft.Callsign != "ASA460" || aircraft.Altitude != 35000 ||
+		aircraft.Latitude != 40.12345 || aircraft.Longitude != -104.54321 ||
+		aircraft.Speed != 451 || aircraft.Heading != 282 ||
+		aircraft.VertRate != 1088 || aircraft.VertRateSign != 1 ||
+		aircraft.Squawk != 0x7700 || !aircraft.Alert || !aircraft.Emergency || !aircraft.Spi || aircraft.Surface {
+		t.Errorf("Merge() = %+v", aircraft)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want error
+	}{
+		{"Status record", "STA,,5,179,400AE7,10103,2008/11/28,14:58:51.153,2008/11/28,14:58:51.153,RM", ErrNotMsg},
+		{"Short record", "MSG,3,111,11111,A6C6C8", ErrNotMsg},
+		{"Bad ICAO", "MSG,3,111,11111,XYZ,111111,,,,,,35000,,,,,,,,,,0", ErrBadField},
+		{"Bad altitude", "MSG,3,111,11111,A6C6C8,111111,,,,,,high,,,,,,,,,,0", ErrBadField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.line); err != tt.want {
+				t.Errorf("Parse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
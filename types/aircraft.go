@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,12 +27,15 @@ type AircraftData struct {
 	IcaoAddr uint32
 
 	Callsign string
+	Category EmitterCategory // Emitter category of identification squitters
 	Squawk   uint32
 
-	ERawLat uint32
-	ERawLon uint32
-	ORawLat uint32
-	ORawLon uint32
+	ERawLat  uint32
+	ERawLon  uint32
+	ORawLat  uint32
+	ORawLon  uint32
+	ERawTime time.Time // When the even position was heard
+	ORawTime time.Time // When the odd position was heard
 
 	Latitude  float64
 	Longitude float64
@@ -48,18 +52,164 @@ type AircraftData struct {
 	VertRateSource uint  // Vertical rate source.
 	VertRateSign   uint  // Vertical rate sign.
 	VertRate       int32 // Vertical rate.
-	Speed          int32
-	Heading        int32
+	Speed          int32 // Ground speed in kt
+	Heading        int32 // Track over ground in whole degrees
 	HeadingIsValid bool
 
+	Track      float64 // Track over ground in degrees
+	MagHeading float64 // Degrees, from airspeed velocity squitters
+	IAS        int32   // kt, 0 when unknown
+	TAS        int32   // kt, 0 when unknown
+	BaroRate   int32   // ft/min of the barometric altitude, negative when descending
+	GeomRate   int32   // ft/min of the geometric height, negative when descending
+	GeomOffset int32   // Geometric height above the barometric altitude in ft
+
 	LastPing time.Time
 	LastPos  time.Time
+	LastES   time.Time // Latest extended squitter, which has the address in the clear
+
+	// Position not shown until it is confirmed by further ones
+	PendingLat   float64
+	PendingLon   float64
+	PendingPos   time.Time
+	PendingCount int
 
 	Rssi float64
 
-	Mlat    bool
+	Receivers      []ReceiverSignal // Receivers currently hearing the aircraft
+	PositionSource string           // Receiver of the latest position
+
+	Alert     bool // Squawk changed
+	Emergency bool
+	Spi       bool // Ident active
+
+	Mlat    bool // Latest position is from multilateration
 	IsValid bool
 	Range   float64
+
+	ModeAC     bool // Mode A/C only target, IcaoAddr is from ModeACAddr
+	ModeAMatch time.Time // Latest Mode A reply with the squawk
+	ModeCMatch time.Time // Latest Mode C reply with the altitude
+
+	EmergencyState uint8  // Emergency or priority state of ES aircraft status, 0 for none
+	ACASRA         string // Active resolution advisory broadcast in ES aircraft status
+
+	NIC  uint8   // Navigation integrity category of the latest position, NUCp for ADS-B version 0
+	Rc   float64 // Radius of containment of the latest position in metres, 0 when unknown
+	NACv uint8   // Navigation accuracy category of the velocity, NUCr for ADS-B version 0
+
+	TargetState *TargetState       // Latest target state and status, nil until heard
+	OpStatus    *OperationalStatus // Latest operational status, nil until heard
+
+	CommB CommBData
+}
+
+// TargetState is the autopilot state of ADS-B version 2 target state and
+// status squitters
+type TargetState struct {
+	SelAltitude int32   // ft, math.MaxInt32 when not available
+	FMSAltitude bool    // SelAltitude is from the FMS rather than the MCP/FCU
+	BaroSetting float64 // mb, math.MaxFloat64 when not available
+	SelHeading  float64 // Degrees, math.MaxFloat64 when not available
+
+	NACp    uint8
+	NICBaro bool
+	SIL     uint8
+
+	ModesValid   bool // The autopilot modes are reported
+	Autopilot    bool
+	VNAV         bool
+	AltitudeHold bool
+	Approach     bool
+	LNAV         bool
+	TCAS         bool // ACAS is operational
+}
+
+// OperationalStatus is what operational status squitters tell of the ADS-B
+// equipment. Version 0 aircraft only report the version.
+type OperationalStatus struct {
+	Version uint8 // ADS-B version, 0 for DO-260, 1 for DO-260A and 2 for DO-260B
+
+	NICSupplementA bool
+	NICSupplementC bool // Surface, version 2
+	NACp           uint8
+	GVA            uint8 // Geometric vertical accuracy, airborne version 2
+	SIL            uint8
+	SILPerSample   bool // SIL is per sample rather than per hour, version 2
+	NICBaro        bool // Airborne
+	TrackAngle     bool // Surface headings are the track rather than the heading
+	HRD            bool // Headings are magnetic rather than true
+
+	// Capability classes
+	ACAS        bool  // Airborne
+	CDTI        bool  // Cockpit display of traffic, version 1
+	ES1090In    bool  // Version 2
+	UATIn       bool  // Version 2
+	ARV         bool  // Air referenced velocity reports, airborne
+	TS          bool  // Target state reports, airborne
+	TC          uint8 // Trajectory change reports, airborne
+	POA         bool  // Position offset applied, surface
+	B2Low       bool  // Transmit power below 70 W, surface
+	NACv        uint8 // Surface version 2
+	LengthWidth uint8 // Surface
+
+	// Operational modes
+	RAActive      bool
+	IdentActive   bool
+	ATCServices   bool  // Receiving ATC services
+	SingleAntenna bool  // Version 2
+	SDA           uint8 // System design assurance, version 2
+}
+
+// CommBData is what Comm-B replies told of an aircraft, from the registers of
+// Enhanced Surveillance. Fields keep their last value until a register
+// reports them again, and stay zero until one does.
+type CommBData struct {
+	SubnetVersion uint8   // Mode S subnetwork version (BDS 1,0)
+	GICB          []uint8 // Registers the transponder supports (BDS 1,7)
+	ACASRA        string  // Active resolution advisory (BDS 3,0)
+
+	SelAltitude int32   // MCP/FCU selected altitude in ft (BDS 4,0)
+	FMSAltitude int32   // FMS selected altitude in ft
+	BaroSetting float64 // mb
+
+	Roll        float64 // Degrees, negative is left wing down (BDS 5,0)
+	TrueTrack   float64 // Degrees
+	TrackRate   float64 // Degrees per second
+	GroundSpeed int32   // kt
+	TAS         int32   // kt
+
+	MagHeading   float64 // Degrees (BDS 6,0)
+	IAS          int32   // kt
+	Mach         float64
+	BaroRate     int32 // ft/min
+	InertialRate int32 // ft/min
+
+	BDS        uint8   // Latest register, 0x40 for 4,0
+	Confidence float64 // That the latest reply was that register, 0 to 1
+	Updated    time.Time
+}
+
+// ModeACAddr is the key of a Mode A/C only target with the given code. It is
+// outside the 24 bit range of ICAO addresses.
+func ModeACAddr(code uint32) uint32 {
+	return 1<<24 | code
+}
+
+// ModeACMatchTimeout is how long a Mode A/C reply counts as matching an
+// aircraft, so that a chance match does not last
+const ModeACMatchTimeout = 30 * time.Second
+
+// ModeAMatched reports whether a Mode A reply with the squawk of the aircraft
+// was heard within ModeACMatchTimeout of now
+func (a *AircraftData) ModeAMatched(now time.Time) bool {
+	return !a.ModeAMatch.IsZero() && now.Sub(a.ModeAMatch) <= ModeACMatchTimeout
+}
+
+// ModeCMatched reports whether a Mode C reply with the altitude of the
+// aircraft was heard within ModeACMatchTimeout of now
+func (a *AircraftData) ModeCMatched(now time.Time) bool {
+	return !a.ModeCMatch.IsZero() && now.Sub(a.ModeCMatch) <= ModeACMatchTimeout
 }
 
 func (a *AircraftData) MarshalJSON() ([]byte, error) {
@@ -79,6 +229,21 @@ func (a *AircraftData) MarshalJSON() ([]byte, error) {
 		squawk = ""
 	}
 
+	var receivers []receiverJSON
+	for _, r := range a.Receivers {
+		rj := receiverJSON{ID: r.Receiver}
+		if !math.IsInf(r.Rssi, 0) && !math.IsNaN(r.Rssi) {
+			rssi := math.Round(r.Rssi*10) / 10
+			rj.Rssi = &rssi
+		}
+		receivers = append(receivers, rj)
+	}
+
+	icao := fmt.Sprintf("%06x", a.IcaoAddr)
+	if a.ModeAC {
+		icao = fmt.Sprintf("~%04x", a.Squawk)
+	}
+
 	var sLat, sLong string
 	if a.Latitude != math.MaxFloat64 &&
 		a.Longitude != math.MaxFloat64 {
@@ -105,10 +270,38 @@ func (a *AircraftData) MarshalJSON() ([]byte, error) {
 		Speed        int32   `json:"spd,omitempty"`
 		Heading      int32   `json:"hdg,omitempty"`
 		Range        float64 `json:"rng,omitempty"`
+		Track        float64 `json:"trk,omitempty"`
+		MagHeading   float64 `json:"maghdg,omitempty"`
+		IAS          int32   `json:"ias,omitempty"`
+		TAS          int32   `json:"tas,omitempty"`
+		BaroRate     int32   `json:"barorate,omitempty"`
+		GeomRate     int32   `json:"georate,omitempty"`
+		GeomOffset   int32   `json:"geodiff,omitempty"`
 		Callsign     string  `json:"call,omitempty"`
+		Category     string  `json:"category,omitempty"`
+		Alert        bool    `json:"alrt,omitempty"`
+		Emergency    bool    `json:"emrg,omitempty"`
+		Spi          bool    `json:"spi,omitempty"`
+
+		Receivers      []receiverJSON `json:"rcvrs,omitempty"`
+		PositionSource string         `json:"possrc,omitempty"`
+
+		ModeAC     bool `json:"modeac,omitempty"`
+		ModeAMatch bool `json:"modea,omitempty"`
+		ModeCMatch bool `json:"modec,omitempty"`
+
+		EmergencyState string           `json:"emrgst,omitempty"`
+		ACASRA         string           `json:"acasra,omitempty"`
+		NIC            uint8            `json:"nic,omitempty"`
+		Rc             float64          `json:"rc,omitempty"`
+		NACv           uint8            `json:"nacv,omitempty"`
+		TargetState    *targetStateJSON `json:"tss,omitempty"`
+		OpStatus       *opStatusJSON    `json:"opstat,omitempty"`
+
+		CommB *commBJSON `json:"commb,omitempty"`
 		//*Alias
 	}{
-		IcaoAddr:     fmt.Sprintf("%06x", a.IcaoAddr),
+		IcaoAddr:     icao,
 		Squawk:       squawk,
 		VertRate:     vertRate,
 		Latitude:     sLat,
@@ -122,11 +315,231 @@ func (a *AircraftData) MarshalJSON() ([]byte, error) {
 		Speed:        a.Speed,
 		Heading:      a.Heading,
 		Range:        a.Range,
+		Track:        math.Round(a.Track*10) / 10,
+		MagHeading:   math.Round(a.MagHeading*10) / 10,
+		IAS:          a.IAS,
+		TAS:          a.TAS,
+		BaroRate:     a.BaroRate,
+		GeomRate:     a.GeomRate,
+		GeomOffset:   a.GeomOffset,
 		Callsign:     a.Callsign,
+		Category:     a.Category.String(),
+		Alert:        a.Alert,
+		Emergency:    a.Emergency,
+		Spi:          a.Spi,
+
+		Receivers:      receivers,
+		PositionSource: a.PositionSource,
+
+		ModeAC:     a.ModeAC,
+		ModeAMatch: a.ModeAMatched(time.Now()),
+		ModeCMatch: a.ModeCMatched(time.Now()),
+
+		EmergencyState: emergencyStates[a.EmergencyState&7],
+		ACASRA:         a.ACASRA,
+		NIC:            a.NIC,
+		Rc:             math.Round(a.Rc*10) / 10,
+		NACv:           a.NACv,
+		TargetState:    a.TargetState.toJSON(),
+		OpStatus:       a.OpStatus.toJSON(),
+
+		CommB: a.CommB.toJSON(),
 		//Alias:    (*Alias)(a),
 	})
 }
 
+// emergencyStates names the emergency or priority states of ES aircraft
+// status, none being empty
+var emergencyStates = [8]string{"", "general", "lifeguard", "minfuel", "nordo", "unlawful", "downed", "reserved"}
+
+type targetStateJSON struct {
+	SelAltitude int32    `json:"selalt,omitempty"`
+	AltSource   string   `json:"altsrc,omitempty"`
+	BaroSetting float64  `json:"baro,omitempty"`
+	SelHeading  *float64 `json:"selhdg,omitempty"`
+	Modes       []string `json:"modes,omitempty"`
+	TCAS        bool     `json:"tcas,omitempty"`
+}
+
+// toJSON returns nil until a target state was heard
+func (ts *TargetState) toJSON() *targetStateJSON {
+	if ts == nil {
+		return nil
+	}
+
+	tj := &targetStateJSON{TCAS: ts.TCAS}
+	if ts.SelAltitude != math.MaxInt32 {
+		tj.SelAltitude = ts.SelAltitude
+		tj.AltSource = "mcp"
+		if ts.FMSAltitude {
+			tj.AltSource = "fms"
+		}
+	}
+	if ts.BaroSetting != math.MaxFloat64 {
+		tj.BaroSetting = math.Round(ts.BaroSetting*10) / 10
+	}
+	if ts.SelHeading != math.MaxFloat64 {
+		heading := math.Round(ts.SelHeading*10) / 10
+		tj.SelHeading = &heading
+	}
+	if ts.ModesValid {
+		for _, mode := range []struct {
+			on   bool
+			name string
+		}{{ts.Autopilot, "autopilot"}, {ts.VNAV, "vnav"}, {ts.AltitudeHold, "althold"}, {ts.Approach, "approach"}, {ts.LNAV, "lnav"}} {
+			if mode.on {
+				tj.Modes = append(tj.Modes, mode.name)
+			}
+		}
+	}
+	return tj
+}
+
+type opStatusJSON struct {
+	Version uint8 `json:"version"`
+	NACp    uint8 `json:"nacp,omitempty"`
+	SIL     uint8 `json:"sil,omitempty"`
+	NICBaro bool  `json:"nicbaro,omitempty"`
+	ACAS    bool  `json:"acas,omitempty"`
+	RA      bool  `json:"raactive,omitempty"`
+	Ident   bool  `json:"ident,omitempty"`
+}
+
+// toJSON returns nil until an operational status was heard
+func (s *OperationalStatus) toJSON() *opStatusJSON {
+	if s == nil {
+		return nil
+	}
+	return &opStatusJSON{
+		Version: s.Version,
+		NACp:    s.NACp,
+		SIL:     s.SIL,
+		NICBaro: s.NICBaro,
+		ACAS:    s.ACAS,
+		RA:      s.RAActive,
+		Ident:   s.IdentActive,
+	}
+}
+
+type commBJSON struct {
+	SubnetVersion uint8    `json:"subnet,omitempty"`
+	GICB          []string `json:"gicb,omitempty"`
+	ACASRA        string   `json:"ra,omitempty"`
+	SelAltitude   int32    `json:"selalt,omitempty"`
+	FMSAltitude   int32    `json:"fmsalt,omitempty"`
+	BaroSetting   float64  `json:"baro,omitempty"`
+	Roll          float64  `json:"roll,omitempty"`
+	TrueTrack     float64  `json:"trk,omitempty"`
+	TrackRate     float64  `json:"trkrate,omitempty"`
+	GroundSpeed   int32    `json:"gs,omitempty"`
+	TAS           int32    `json:"tas,omitempty"`
+	MagHeading    float64  `json:"maghdg,omitempty"`
+	IAS           int32    `json:"ias,omitempty"`
+	Mach          float64  `json:"mach,omitempty"`
+	BaroRate      int32    `json:"barorate,omitempty"`
+	InertialRate  int32    `json:"insrate,omitempty"`
+	BDS           string   `json:"bds"`
+	Confidence    float64  `json:"conf"`
+}
+
+// toJSON returns nil until a Comm-B register was decoded
+func (c *CommBData) toJSON() *commBJSON {
+	if c.Updated.IsZero() {
+		return nil
+	}
+
+	var gicb []string
+	for _, bds := range c.GICB {
+		gicb = append(gicb, bdsName(bds))
+	}
+
+	round := func(v float64, digits float64) float64 {
+		scale := math.Pow(10, digits)
+		return math.Round(v*scale) / scale
+	}
+
+	return &commBJSON{
+		SubnetVersion: c.SubnetVersion,
+		GICB:          gicb,
+		ACASRA:        c.ACASRA,
+		SelAltitude:   c.SelAltitude,
+		FMSAltitude:   c.FMSAltitude,
+		BaroSetting:   round(c.BaroSetting, 1),
+		Roll:          round(c.Roll, 1),
+		TrueTrack:     round(c.TrueTrack, 1),
+		TrackRate:     round(c.TrackRate, 2),
+		GroundSpeed:   c.GroundSpeed,
+		TAS:           c.TAS,
+		MagHeading:    round(c.MagHeading, 1),
+		IAS:           c.IAS,
+		Mach:          round(c.Mach, 3),
+		BaroRate:      c.BaroRate,
+		InertialRate:  c.InertialRate,
+		BDS:           bdsName(c.BDS),
+		Confidence:    round(c.Confidence, 2),
+	}
+}
+
+// bdsName writes a register the way it is usually written, 0x40 as "4,0"
+func bdsName(bds uint8) string {
+	return fmt.Sprintf("%X,%X", bds>>4, bds&15)
+}
+
+type receiverJSON struct {
+	ID   string   `json:"id"`
+	Rssi *float64 `json:"rssi,omitempty"`
+}
+
+// ReceiverTimeout is how long a receiver counts as hearing an aircraft after
+// its last message
+const ReceiverTimeout = 30 * time.Second
+
+// Reception is one receiver hearing a message. Rssi is -Inf when unknown.
+type Reception struct {
+	Receiver string
+	Rssi     float64
+}
+
+// ReceiverSignal is the latest signal of one receiver hearing an aircraft
+type ReceiverSignal struct {
+	Receiver string
+	Rssi     float64
+	LastSeen time.Time
+}
+
+// Heard records the receivers of a message and forgets those that have not
+// heard the aircraft within ReceiverTimeout. Receivers is replaced rather than
+// modified, as outputs may still be reading older copies of the aircraft.
+func (a *AircraftData) Heard(receptions []Reception, now time.Time) {
+	if len(receptions) == 0 && len(a.Receivers) == 0 {
+		return
+	}
+
+	receivers := make([]ReceiverSignal, 0, len(a.Receivers)+len(receptions))
+	for _, r := range a.Receivers {
+		if now.Sub(r.LastSeen) <= ReceiverTimeout && !heardBy(receptions, r.Receiver) {
+			receivers = append(receivers, r)
+		}
+	}
+	for _, r := range receptions {
+		receivers = append(receivers, ReceiverSignal{Receiver: r.Receiver, Rssi: r.Rssi, LastSeen: now})
+	}
+
+	sort.Slice(receivers, func(i, j int) bool {
+		return receivers[i].Receiver < receivers[j].Receiver
+	})
+	a.Receivers = receivers
+}
+
+func heardBy(receptions []Reception, receiver string) bool {
+	for _, r := range receptions {
+		if r.Receiver == receiver {
+			return true
+		}
+	}
+	return false
+}
+
 type AircraftMap struct {
 	sync.RWMutex
 	internal map[uint32]*AircraftData
@@ -168,6 +581,18 @@ func (am *AircraftMap) Len() (length int) {
 	return result
 }
 
+// Range calls f for each aircraft until it returns false, without copying the
+// map. f must not modify the map.
+func (am *AircraftMap) Range(f func(aircraft *AircraftData) bool) {
+	am.RLock()
+	defer am.RUnlock()
+	for _, ac := range am.internal {
+		if !f(ac) {
+			return
+		}
+	}
+}
+
 func (am *AircraftMap) Copy() ([]*AircraftData) {
 	am.RLock()
 	//defer am.RUnlock()
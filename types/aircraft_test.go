@@ -0,0 +1,150 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAircraftData_Heard(t *testing.T) {
+	now := time.Now()
+	aircraft := &AircraftData{Latitude: math.MaxFloat64, Longitude: math.MaxFloat64}
+
+	aircraft.Heard([]Reception{{"piaware:30005", -12.5}, {"feeder", math.Inf(-1)}}, now.Add(-25*time.Second))
+	aircraft.Heard([]Reception{{"rooftop", -20.04}}, now.Add(-time.Second))
+	previous := aircraft.Receivers
+	aircraft.Heard([]Reception{{"piaware:30005", -3}}, now.Add(10*time.Second))
+
+	// The receivers heard 35s ago have timed out, except the one heard again
+	if len(aircraft.Receivers) != 2 || aircraft.Receivers[0].Receiver != "piaware:30005" ||
+		aircraft.Receivers[0].Rssi != -3 || aircraft.Receivers[1].Receiver != "rooftop" {
+		t.Errorf("Heard() receivers = %+v", aircraft.Receivers)
+	}
+	if len(previous) != 3 || previous[1].Rssi != -12.5 {
+		t.Errorf("Heard() modified the previous receivers: %+v", previous)
+	}
+
+	aircraft.Heard([]Reception{{"feeder", math.Inf(-1)}}, now)
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"rcvrs":[{"id":"feeder"},{"id":"piaware:30005","rssi":-3},{"id":"rooftop","rssi":-20}]`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("MarshalJSON() = %s, want %s", data, want)
+	}
+}
+
+func TestAircraftData_MarshalJSON_ModeAC(t *testing.T) {
+	aircraft := &AircraftData{IcaoAddr: ModeACAddr(0x7700), Squawk: 0x7700, ModeAC: true,
+		Latitude: math.MaxFloat64, Longitude: math.MaxFloat64}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"icao":"~7700"`, `"xpdr":"7700"`, `"modeac":true`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("MarshalJSON() = %s, want %s", data, want)
+		}
+	}
+}
+
+func TestAircraftData_MarshalJSON_ModeACMatch(t *testing.T) {
+	now := time.Now()
+	aircraft := &AircraftData{IcaoAddr: 0x4840d6, Squawk: 0x7700, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64,
+		ModeAMatch: now, ModeCMatch: now.Add(-2 * ModeACMatchTimeout)}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"modea":true`) || strings.Contains(string(data), `"modec"`) {
+		t.Errorf("MarshalJSON() = %s, want a Mode A match and the Mode C one expired", data)
+	}
+}
+
+func TestAircraftData_MarshalJSON_CommB(t *testing.T) {
+	aircraft := &AircraftData{IcaoAddr: 0x40621d, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"commb"`) {
+		t.Errorf("MarshalJSON() = %s, want no commb before a register is decoded", data)
+	}
+
+	aircraft.CommB = CommBData{GICB: []uint8{0x20, 0x40}, SelAltitude: 3008, BaroSetting: 1020,
+		BDS: 0x40, Confidence: 1, Updated: time.Now()}
+	if data, err = json.Marshal(aircraft); err != nil {
+		t.Fatal(err)
+	}
+	want := `"commb":{"gicb":["2,0","4,0"],"selalt":3008,"baro":1020,"bds":"4,0","conf":1}`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("MarshalJSON() = %s, want %s", data, want)
+	}
+}
+
+func TestAircraftData_MarshalJSON_Status(t *testing.T) {
+	aircraft := &AircraftData{IcaoAddr: 0xa05629, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64,
+		EmergencyState: 2, Emergency: true, NIC: 8, Rc: 185.2,
+		TargetState: &TargetState{SelAltitude: 16992, BaroSetting: math.MaxFloat64, SelHeading: 0,
+			ModesValid: true, Autopilot: true, LNAV: true},
+		OpStatus: &OperationalStatus{Version: 2, NACp: 10, SIL: 3}}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"emrgst":"lifeguard"`, `"nic":8,"rc":185.2`,
+		`"tss":{"selalt":16992,"altsrc":"mcp","selhdg":0,"modes":["autopilot","lnav"]}`,
+		`"opstat":{"version":2,"nacp":10,"sil":3}`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("MarshalJSON() = %s, want %s", data, want)
+		}
+	}
+}
+
+func TestAircraftData_MarshalJSON_Velocity(t *testing.T) {
+	aircraft := &AircraftData{IcaoAddr: 0x485020, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64,
+		Speed: 159, Heading: 183, Track: 182.8803, MagHeading: 180.51, IAS: 250, BaroRate: -832, GeomOffset: 550}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"spd":159,"hdg":183,"trk":182.9,"maghdg":180.5,"ias":250,"barorate":-832,"geodiff":550`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("MarshalJSON() = %s, want %s", data, want)
+	}
+}
+
+func TestAircraftData_MarshalJSON_Category(t *testing.T) {
+	aircraft := &AircraftData{IcaoAddr: 0x4840d6, Latitude: math.MaxFloat64, Longitude: math.MaxFloat64,
+		Callsign: "KLM1023", Category: 0xa3}
+	data, err := json.Marshal(aircraft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"call":"KLM1023","category":"A3"`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("MarshalJSON() = %s, want %s", data, want)
+	}
+
+	aircraft.Category = 0
+	if data, _ = json.Marshal(aircraft); strings.Contains(string(data), "category") {
+		t.Errorf("MarshalJSON() = %s, want no unknown category", data)
+	}
+}
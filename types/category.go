@@ -0,0 +1,83 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmitterCategory is the kind of aircraft or vehicle an identification
+// squitter reports. The set, A to D, is in the high nibble and the category
+// within it in the low one, so 0xa7 is category A7. Zero when unknown.
+type EmitterCategory uint8
+
+var categoryDescriptions = map[EmitterCategory]string{
+	0xa1: "light",
+	0xa2: "small",
+	0xa3: "large",
+	0xa4: "high vortex large",
+	0xa5: "heavy",
+	0xa6: "high performance",
+	0xa7: "rotorcraft",
+	0xb1: "glider",
+	0xb2: "lighter than air",
+	0xb3: "parachutist",
+	0xb4: "ultralight",
+	0xb6: "UAV",
+	0xb7: "space vehicle",
+	0xc1: "surface emergency vehicle",
+	0xc2: "surface service vehicle",
+	0xc3: "point obstacle",
+	0xc4: "cluster obstacle",
+	0xc5: "line obstacle",
+}
+
+// NewEmitterCategory returns the category of an identification squitter with
+// type code tc (1 to 4 for sets D to A) and category ca, which is unknown when
+// the squitter has no category information
+func NewEmitterCategory(tc, ca uint8) EmitterCategory {
+	if tc < 1 || tc > 4 || ca == 0 || ca > 7 {
+		return 0
+	}
+	return EmitterCategory((0xe-tc)<<4 | ca)
+}
+
+// String returns the code of the category, e.g. A7, or "" when it is unknown
+func (c EmitterCategory) String() string {
+	if c == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%X", uint8(c))
+}
+
+// Description returns what the category stands for, reserved for categories
+// of no defined meaning
+func (c EmitterCategory) Description() string {
+	if c == 0 {
+		return ""
+	}
+	if d, ok := categoryDescriptions[c]; ok {
+		return d
+	}
+	return "reserved"
+}
+
+// Matches reports whether the category is code, e.g. A7, or is in the set
+// code names, e.g. C. Unknown categories match nothing.
+func (c EmitterCategory) Matches(code string) bool {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return c != 0 && code != "" && strings.HasPrefix(c.String(), code)
+}
@@ -0,0 +1,67 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "testing"
+
+func TestNewEmitterCategory(t *testing.T) {
+	tests := []struct {
+		name            string
+		tc, ca          uint8
+		want            string
+		wantDescription string
+	}{
+		{"heavy", 4, 5, "A5", "heavy"},
+		{"rotorcraft", 4, 7, "A7", "rotorcraft"},
+		{"UAV", 3, 6, "B6", "UAV"},
+		{"reserved", 3, 5, "B5", "reserved"},
+		{"surface vehicle", 2, 2, "C2", "surface service vehicle"},
+		{"set D", 1, 1, "D1", "reserved"},
+		{"no information", 4, 0, "", ""},
+		{"not an identification", 5, 1, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewEmitterCategory(tt.tc, tt.ca)
+			if c.String() != tt.want || c.Description() != tt.wantDescription {
+				t.Errorf("NewEmitterCategory() = %s (%s), want %s (%s)", c, c.Description(), tt.want, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestEmitterCategory_Matches(t *testing.T) {
+	tests := []struct {
+		name     string
+		category EmitterCategory
+		code     string
+		want     bool
+	}{
+		{"code", 0xa7, "A7", true},
+		{"lower case", 0xa7, " a7", true},
+		{"other code", 0xa7, "A1", false},
+		{"set", 0xc1, "C", true},
+		{"other set", 0xc1, "A", false},
+		{"unknown", 0, "A", false},
+		{"empty code", 0xa7, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.category.Matches(tt.code); got != tt.want {
+				t.Errorf("Matches(%q) = %t, want %t", tt.code, got, tt.want)
+			}
+		})
+	}
+}
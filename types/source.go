@@ -0,0 +1,182 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type SourceState string
+
+const (
+	SourceConnecting SourceState = "connecting"
+	SourceConnected  SourceState = "connected"
+	SourceBackoff    SourceState = "backoff"
+	SourceFailed     SourceState = "failed"
+)
+
+// Source kinds
+const (
+	SourceClient = "client"
+	SourceFeeder = "feeder"
+	SourceReplay = "replay"
+)
+
+// DefaultSourceRegistry holds the health of every input, like metrics.DefaultRegistry
+var DefaultSourceRegistry = NewSourceRegistry()
+
+// SourceStatus is a snapshot of the health of a single input
+type SourceStatus struct {
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"`
+	State      SourceState `json:"state"`
+	Bytes      int64       `json:"bytes"`
+	Frames     int64       `json:"frames"`
+	LastFrame  time.Time   `json:"lastFrame"`
+	Since      time.Time   `json:"since"` // Time of the last state change
+	Reconnects int         `json:"reconnects"`
+	LastError  string      `json:"error,omitempty"`
+}
+
+// SourceHealth tracks a single input across reconnects
+type SourceHealth struct {
+	sync.RWMutex
+	status    SourceStatus
+	connected bool // Connected at least once, so the next connect is a reconnect
+}
+
+func (h *SourceHealth) setState(state SourceState) {
+	if h.status.State != state {
+		h.status.State = state
+		h.status.Since = time.Now()
+	}
+}
+
+func (h *SourceHealth) Connecting() {
+	h.Lock()
+	h.setState(SourceConnecting)
+	h.Unlock()
+}
+
+func (h *SourceHealth) Connected() {
+	h.Lock()
+	if h.connected {
+		h.status.Reconnects++
+	}
+	h.connected = true
+	h.setState(SourceConnected)
+	h.Unlock()
+}
+
+// Backoff records a failed attempt or lost connection that will be retried
+func (h *SourceHealth) Backoff(err error) {
+	h.Lock()
+	h.setState(SourceBackoff)
+	if err != nil {
+		h.status.LastError = err.Error()
+	}
+	h.Unlock()
+}
+
+// Failed records an error that will not be retried
+func (h *SourceHealth) Failed(err error) {
+	h.Lock()
+	h.setState(SourceFailed)
+	if err != nil {
+		h.status.LastError = err.Error()
+	}
+	h.Unlock()
+}
+
+func (h *SourceHealth) AddBytes(n int) {
+	h.Lock()
+	h.status.Bytes += int64(n)
+	h.Unlock()
+}
+
+func (h *SourceHealth) Frame() {
+	h.Lock()
+	h.status.Frames++
+	h.status.LastFrame = time.Now()
+	h.Unlock()
+}
+
+// Idle returns how long the source has been connected without delivering a frame
+func (h *SourceHealth) Idle() time.Duration {
+	h.RLock()
+	defer h.RUnlock()
+
+	if h.status.State != SourceConnected {
+		return 0
+	}
+	if h.status.LastFrame.After(h.status.Since) {
+		return time.Since(h.status.LastFrame)
+	}
+	return time.Since(h.status.Since)
+}
+
+func (h *SourceHealth) Status() SourceStatus {
+	h.RLock()
+	defer h.RUnlock()
+	return h.status
+}
+
+type SourceRegistry struct {
+	sync.RWMutex
+	internal map[string]*SourceHealth
+}
+
+func NewSourceRegistry() *SourceRegistry {
+	return &SourceRegistry{
+		internal: make(map[string]*SourceHealth),
+	}
+}
+
+// Register returns the health of the named source, creating it if needed so
+// that counters survive reconnects
+func (r *SourceRegistry) Register(name string, kind string) *SourceHealth {
+	r.Lock()
+	defer r.Unlock()
+
+	if h, ok := r.internal[name]; ok {
+		return h
+	}
+	h := &SourceHealth{status: SourceStatus{Name: name, Kind: kind, State: SourceConnecting, Since: time.Now()}}
+	r.internal[name] = h
+	return h
+}
+
+func (r *SourceRegistry) Unregister(name string) {
+	r.Lock()
+	delete(r.internal, name)
+	r.Unlock()
+}
+
+// Statuses returns a snapshot of every source sorted by name
+func (r *SourceRegistry) Statuses() []SourceStatus {
+	r.RLock()
+	result := make([]SourceStatus, 0, len(r.internal))
+	for _, h := range r.internal {
+		result = append(result, h.Status())
+	}
+	r.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
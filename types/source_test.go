@@ -0,0 +1,54 @@
+// Copyright © 2018 Chris Custine <ccustine@apache.org>
+//
+// Licensed under the Apache License, version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSourceHealth_Lifecycle(t *testing.T) {
+	registry := NewSourceRegistry()
+	health := registry.Register("piaware:30005", SourceClient)
+
+	health.Connecting()
+	health.Connected()
+	health.AddBytes(16)
+	health.Frame()
+	health.Backoff(errors.New("connection reset by peer"))
+	if health.Idle() != 0 {
+		t.Errorf("Idle() = %s while disconnected, want 0", health.Idle())
+	}
+	health.Connected()
+
+	if registry.Register("piaware:30005", SourceClient) != health {
+		t.Error("Register() did not return the existing source")
+	}
+
+	statuses := registry.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("Statuses() returned %d sources, want 1", len(statuses))
+	}
+	status := statuses[0]
+	if status.State != SourceConnected || status.Bytes != 16 || status.Frames != 1 ||
+		status.Reconnects != 1 || status.LastError != "connection reset by peer" || status.LastFrame.IsZero() {
+		t.Errorf("Statuses() = %+v", status)
+	}
+
+	registry.Unregister("piaware:30005")
+	if len(registry.Statuses()) != 0 {
+		t.Error("Unregister() left the source registered")
+	}
+}